@@ -10,15 +10,25 @@ import (
 	s "github.com/webtor-io/video-info/services"
 	"github.com/webtor-io/video-info/services/osdb"
 	"github.com/webtor-io/video-info/services/redis"
+	"github.com/webtor-io/video-info/services/retry"
 	"github.com/webtor-io/video-info/services/s3"
 )
 
 func configure(app *cli.App) {
 	app.Flags = []cli.Flag{}
 	app.Flags = cs.RegisterProbeFlags(app.Flags)
+	app.Flags = cs.RegisterPromFlags(app.Flags)
 	app.Flags = s.RegisterWebFlags(app.Flags)
+	app.Flags = s.RegisterRankerFlags(app.Flags)
+	app.Flags = s.RegisterSearchChainFlags(app.Flags)
+	app.Flags = s.RegisterProvidersFlags(app.Flags)
+	app.Flags = s.RegisterLocalProviderFlags(app.Flags)
 	app.Flags = osdb.RegisterOSDBClientFlags(app.Flags)
+	app.Flags = osdb.RegisterXMLRPCClientFlags(app.Flags)
+	app.Flags = osdb.RegisterBreakerFlags(app.Flags)
+	app.Flags = retry.RegisterPolicyFlags(app.Flags)
 	app.Flags = cs.RegisterRedisClientFlags(app.Flags)
+	app.Flags = redis.RegisterCacheFlags(app.Flags)
 	app.Flags = cs.RegisterS3ClientFlags(app.Flags)
 	app.Flags = s3.RegisterS3StorageFlags(app.Flags)
 
@@ -38,36 +48,79 @@ func run(c *cli.Context) error {
 	redisClient := cs.NewRedisClient(c)
 
 	// Setting cachePool
-	cachePool := redis.NewCachePool(redisClient)
+	cachePool := redis.NewCachePool(c, redisClient)
 
 	// Setting HTTP Client
 	httpClient := http.DefaultClient
 
+	// Setting retryPolicy
+	retryPolicy := retry.NewPolicy(c)
+
+	// Setting osdbBreaker
+	osdbBreaker := osdb.NewBreaker(c)
+
 	// Setting OSDB Client
-	client := osdb.NewClient(c, httpClient)
+	client, err := osdb.NewClient(c, httpClient, retryPolicy, osdbBreaker)
+	if err != nil {
+		return err
+	}
+
+	// Setting available providers
+	available := []s.Provider{s.NewOpenSubtitlesProvider(client)}
+	if lp := s.NewLocalProvider(c); lp != nil {
+		available = append(available, lp)
+	}
+	if xcl := osdb.NewXMLRPCClient(c, httpClient, retryPolicy, osdb.NewBreaker(c)); xcl != nil {
+		available = append(available, s.NewOpenSubtitlesXMLRPCProvider(xcl))
+	}
+
+	// Setting providers
+	providers, err := s.NewProviders(c, available...)
+	if err != nil {
+		return err
+	}
 
 	// Setting searchPool
-	searchPool := s.NewSearchPool(client)
+	searchPool := s.NewSearchPool(retryPolicy, s3st)
 
 	// Setting imdbSearchPool
-	imdbSearchPool := s.NewIMDBSearchPool(client)
+	imdbSearchPool := s.NewIMDBSearchPool(s3st)
+
+	// Setting querySearchPool
+	querySearchPool := s.NewQuerySearchPool(s3st)
+
+	// Setting searchChain
+	searchChain := s.NewSearchChain(c, providers, searchPool, imdbSearchPool, querySearchPool, cachePool)
 
 	// Setting subsPool
-	subsPool := s.NewSubsPool(client, s3st)
+	subsPool := s.NewSubsPool(s3st)
+
+	// Setting embeddedSubsPool
+	embeddedSubsPool := s.NewEmbeddedSubsPool(s3st, retryPolicy)
+
+	// Setting mediaInfoPool
+	mediaInfoPool := s.NewMediaInfoPool(retryPolicy)
+
+	// Setting ranker
+	ranker := s.NewRanker(c)
 
 	// Setting ProbeService
 	probe := cs.NewProbe(c)
 	defer probe.Close()
 
+	// Setting PromService
+	prom := cs.NewProm(c)
+	defer prom.Close()
+
 	// Setting WebService
-	web := s.NewWeb(c, searchPool, imdbSearchPool, subsPool, cachePool)
+	web := s.NewWeb(c, providers, searchChain, subsPool, embeddedSubsPool, mediaInfoPool, cachePool, ranker)
 	defer web.Close()
 
 	// Setting ServeService
-	serve := cs.NewServe(probe, web)
+	serve := cs.NewServe(probe, prom, web)
 
 	// And SERVE!
-	err := serve.Serve()
+	err = serve.Serve()
 	if err != nil {
 		log.WithError(err).Error("Got server error")
 	}
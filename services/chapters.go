@@ -0,0 +1,22 @@
+package services
+
+import (
+	"time"
+
+	"github.com/webtor-io/video-info/services/media"
+	"github.com/webtor-io/video-info/services/subconv"
+)
+
+const chaptersKind = "chapters"
+
+// makeChaptersVTT renders container chapters as WebVTT chapters track.
+func makeChaptersVTT(cs []media.Chapter) []byte {
+	t := &subconv.Track{}
+	sec := func(v float64) time.Duration {
+		return time.Duration(v * float64(time.Second))
+	}
+	for _, c := range cs {
+		t.Add(sec(c.Start), sec(c.End), c.Title)
+	}
+	return subconv.WriteVTT(t)
+}
@@ -0,0 +1,211 @@
+package charset
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+const (
+	UTF8        = "utf-8"
+	UTF16LE     = "utf-16le"
+	UTF16BE     = "utf-16be"
+	Windows1250 = "windows-1250"
+	Windows1251 = "windows-1251"
+	Windows1252 = "windows-1252"
+	ISO88592    = "iso-8859-2"
+	GB18030     = "gb18030"
+)
+
+var encodings = map[string]encoding.Encoding{
+	UTF16LE:     xunicode.UTF16(xunicode.LittleEndian, xunicode.IgnoreBOM),
+	UTF16BE:     xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM),
+	Windows1250: charmap.Windows1250,
+	Windows1251: charmap.Windows1251,
+	Windows1252: charmap.Windows1252,
+	ISO88592:    charmap.ISO8859_2,
+	GB18030:     simplifiedchinese.GB18030,
+}
+
+// candidates are 8-bit encodings checked when data is not valid UTF-8
+var candidates = []string{Windows1252, Windows1250, Windows1251, ISO88592, GB18030}
+
+// hints map subtitle language to the most common legacy encoding
+var hints = map[string]string{
+	"ru": Windows1251, "uk": Windows1251, "be": Windows1251, "bg": Windows1251,
+	"sr": Windows1251, "mk": Windows1251,
+	"pl": Windows1250, "cs": Windows1250, "sk": Windows1250, "hu": Windows1250,
+	"ro": Windows1250, "hr": Windows1250, "sl": Windows1250, "bs": Windows1250,
+	"zh": GB18030, "zh-cn": GB18030, "ze": GB18030,
+}
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// Detect guesses charset of data. lang is an optional language of the text,
+// it is used to break ties between similar 8-bit encodings.
+func Detect(data []byte, lang string) string {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return UTF8
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return UTF16LE
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return UTF16BE
+	}
+	if cs := detectUTF16(data); cs != "" {
+		return cs
+	}
+	if utf8.Valid(data) {
+		return UTF8
+	}
+	hint := hints[strings.ToLower(lang)]
+	if hint == "" {
+		primary, _, _ := strings.Cut(strings.ToLower(lang), "-")
+		hint = hints[primary]
+	}
+	best := ""
+	bestScore := 0.0
+	for _, c := range candidates {
+		d, err := encodings[c].NewDecoder().Bytes(data)
+		if err != nil {
+			continue
+		}
+		sc := score(string(d))
+		if c == hint {
+			sc += 0.1 * abs(sc)
+		}
+		if best == "" || sc > bestScore {
+			best = c
+			bestScore = sc
+		}
+	}
+	if best == "" {
+		return Windows1252
+	}
+	return best
+}
+
+// detectUTF16 detects BOM-less UTF-16 by zero bytes in ASCII characters.
+func detectUTF16(data []byte) string {
+	n := len(data)
+	if n > 4096 {
+		n = 4096
+	}
+	n -= n % 2
+	if n < 4 {
+		return ""
+	}
+	var even, odd int
+	for i := 0; i < n; i += 2 {
+		if data[i] == 0 {
+			even++
+		}
+		if data[i+1] == 0 {
+			odd++
+		}
+	}
+	half := n / 2
+	if odd*10 > half*3 && even*20 < half {
+		return UTF16LE
+	}
+	if even*10 > half*3 && odd*20 < half {
+		return UTF16BE
+	}
+	return ""
+}
+
+// score estimates how plausible decoded text is. Non-ASCII letters score
+// positively when they form words typical for their script, control and
+// replacement characters are heavily penalized.
+func score(text string) float64 {
+	sc := 0.0
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, w := range words {
+		var ascii, latin, cyrillic, han, other, total int
+		for _, r := range w {
+			total++
+			switch {
+			case r < utf8.RuneSelf:
+				ascii++
+			case unicode.Is(unicode.Latin, r):
+				latin++
+			case unicode.Is(unicode.Cyrillic, r):
+				cyrillic++
+			case unicode.Is(unicode.Han, r):
+				han++
+			default:
+				other++
+			}
+		}
+		nonASCII := total - ascii
+		if nonASCII == 0 {
+			continue
+		}
+		switch {
+		case han > 0 && ascii == 0:
+			// han characters take two bytes, so they count twice to compete
+			// with 8-bit encodings
+			sc += float64(2*han) - float64(latin+cyrillic+other)
+		case han > 0 || mixedCase(w):
+			sc -= float64(nonASCII)
+		case cyrillic > 0 && cyrillic == nonASCII && ascii == 0:
+			sc += float64(cyrillic)
+		case latin > 0 && latin == nonASCII && (ascii > 0 || total <= 2):
+			sc += float64(latin)
+		default:
+			sc -= float64(nonASCII)
+		}
+	}
+	for _, r := range text {
+		if r == utf8.RuneError || (unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t') {
+			sc -= 5
+		}
+	}
+	return sc
+}
+
+// mixedCase tells whether word has upper case letter after lower case one,
+// which is rare in real text but common for misdecoded one.
+func mixedCase(w string) bool {
+	lower := false
+	for _, r := range w {
+		if lower && unicode.IsUpper(r) {
+			return true
+		}
+		lower = unicode.IsLower(r)
+	}
+	return false
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+// ToUTF8 converts data to UTF-8 without BOM. Returns detected source charset.
+func ToUTF8(data []byte, lang string) ([]byte, string, error) {
+	cs := Detect(data, lang)
+	if cs == UTF8 {
+		return bytes.TrimPrefix(data, bomUTF8), cs, nil
+	}
+	d, err := encodings[cs].NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, cs, errors.Wrapf(err, "failed to decode %v", cs)
+	}
+	return bytes.TrimPrefix(d, bomUTF8), cs, nil
+}
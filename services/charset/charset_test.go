@@ -0,0 +1,158 @@
+package charset
+
+import (
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func encode(t *testing.T, e encoding.Encoding, s string) []byte {
+	t.Helper()
+	d, err := e.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatalf("failed to encode %q: %v", s, err)
+	}
+	return d
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		data func(t *testing.T) []byte
+		lang string
+		want string
+	}{
+		{
+			name: "ascii",
+			data: func(t *testing.T) []byte { return []byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n") },
+			want: UTF8,
+		},
+		{
+			name: "utf-8",
+			data: func(t *testing.T) []byte { return []byte("Привет, мир") },
+			want: UTF8,
+		},
+		{
+			name: "utf-8 bom",
+			data: func(t *testing.T) []byte { return append([]byte{0xEF, 0xBB, 0xBF}, "Hello"...) },
+			want: UTF8,
+		},
+		{
+			name: "utf-16le bom",
+			data: func(t *testing.T) []byte { return []byte{0xFF, 0xFE, 'H', 0, 'i', 0} },
+			want: UTF16LE,
+		},
+		{
+			name: "utf-16be without bom",
+			data: func(t *testing.T) []byte { return []byte{0, 'H', 0, 'e', 0, 'l', 0, 'l', 0, 'o'} },
+			want: UTF16BE,
+		},
+		{
+			name: "utf-16le without bom",
+			data: func(t *testing.T) []byte { return []byte{'H', 0, 'e', 0, 'l', 0, 'l', 0, 'o', 0} },
+			want: UTF16LE,
+		},
+		{
+			name: "windows-1251",
+			data: func(t *testing.T) []byte {
+				return encode(t, charmap.Windows1251, "Привет, как дела? Всё хорошо.")
+			},
+			want: Windows1251,
+		},
+		{
+			name: "windows-1252",
+			data: func(t *testing.T) []byte {
+				return encode(t, charmap.Windows1252, "Où est la bibliothèque? Très bien, merci.")
+			},
+			want: Windows1252,
+		},
+		{
+			name: "windows-1250",
+			data: func(t *testing.T) []byte {
+				return encode(t, charmap.Windows1250, "Dziękuję, że przyszłaś. Świetnie się bawiłem.")
+			},
+			lang: "pl",
+			want: Windows1250,
+		},
+		{
+			name: "windows-1250 without hint",
+			data: func(t *testing.T) []byte {
+				return encode(t, charmap.Windows1250, "Śmieszne źdźbło, ślimak")
+			},
+			want: Windows1250,
+		},
+		{
+			name: "iso-8859-2",
+			data: func(t *testing.T) []byte {
+				return encode(t, charmap.ISO8859_2, "Śmieszne źdźbło, ślimak")
+			},
+			lang: "pl",
+			want: ISO88592,
+		},
+		{
+			name: "gb18030",
+			data: func(t *testing.T) []byte {
+				return encode(t, simplifiedchinese.GB18030, "你好，世界。我们走吧。")
+			},
+			lang: "zh-CN",
+			want: GB18030,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.data(t), tt.lang); got != tt.want {
+				t.Errorf("Detect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		lang    string
+		want    string
+		charset string
+	}{
+		{
+			name:    "strips bom",
+			data:    append([]byte{0xEF, 0xBB, 0xBF}, "Hello"...),
+			want:    "Hello",
+			charset: UTF8,
+		},
+		{
+			name:    "utf-16le",
+			data:    []byte{0xFF, 0xFE, 'H', 0, 'i', 0},
+			want:    "Hi",
+			charset: UTF16LE,
+		},
+		{
+			name:    "windows-1251",
+			data:    []byte{0xcf, 0xf0, 0xe8, 0xe2, 0xe5, 0xf2},
+			lang:    "ru",
+			want:    "Привет",
+			charset: Windows1251,
+		},
+		{
+			name:    "windows-1250",
+			data:    []byte{'D', 'o', 'b', 'r', 0xfd, ' ', 'd', 'e', 'n', ',', ' ', 0x9a, 'k', 'o', 'l', 'a'},
+			lang:    "cs",
+			want:    "Dobrý den, škola",
+			charset: Windows1250,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cs, err := ToUTF8(tt.data, tt.lang)
+			if err != nil {
+				t.Fatalf("ToUTF8() error = %v", err)
+			}
+			if string(got) != tt.want || cs != tt.charset {
+				t.Errorf("ToUTF8() = %q, %v, want %q, %v", got, cs, tt.want, tt.charset)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/webtor-io/video-info/services/media"
+	"github.com/webtor-io/video-info/services/redis"
+	"github.com/webtor-io/video-info/services/retry"
+	s "github.com/webtor-io/video-info/services/s3"
+	"github.com/webtor-io/video-info/services/subconv"
+)
+
+type EmbeddedSub struct {
+	url    string
+	source string
+	track  int
+	format string
+	orig   *EmbeddedSub
+	cache  *redis.Cache
+	s3     *s.S3Storage
+	retry  *retry.Policy
+	value  []byte
+	inited bool
+	err    error
+	mux    sync.Mutex
+	logger *logrus.Entry
+}
+
+// NewEmbeddedSub makes subtitle extracted from text track of source container.
+// Track is extracted once as WebVTT, every other format is converted from orig.
+// source identifies the video for S3 storage.
+func NewEmbeddedSub(url string, source string, track int, format string, orig *EmbeddedSub, c *redis.Cache, s3 *s.S3Storage, r *retry.Policy, logger *logrus.Entry) *EmbeddedSub {
+	return &EmbeddedSub{
+		url:    url,
+		source: source,
+		track:  track,
+		format: format,
+		orig:   orig,
+		cache:  c,
+		s3:     s3,
+		retry:  r,
+		logger: logger,
+	}
+}
+
+func (s *EmbeddedSub) get(ctx context.Context, purge bool) ([]byte, error) {
+	if !purge {
+		subtitle, err := s.cache.GetEmbeddedSubtitle(ctx, s.track, s.format)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get embedded subtitle from cache")
+		}
+		if subtitle != nil {
+			return subtitle, nil
+		}
+		if s.s3 != nil {
+			subtitle, err := s.s3.GetEmbeddedSub(s.source, s.track, s.format)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to get embedded subtitle from s3")
+			}
+			if subtitle != nil {
+				return subtitle, nil
+			}
+		}
+	}
+	var d []byte
+	var err error
+	if s.orig == nil {
+		d, err = s.extract(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to extract subtitle")
+		}
+	} else {
+		d, err = s.convert(ctx, purge)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert subtitle")
+		}
+	}
+	err = s.cache.SetEmbeddedSubtitle(ctx, s.track, s.format, d)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to store embedded subtitle in cache")
+	}
+	if s.s3 != nil {
+		err := s.s3.PutEmbeddedSub(s.source, s.track, s.format, d)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to store embedded subtitle in s3")
+		}
+	}
+	return d, nil
+}
+
+func (s *EmbeddedSub) extract(ctx context.Context) ([]byte, error) {
+	r := newSourceRangeReader(ctx, s.url, s.retry)
+	size, err := r.Size()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read size")
+	}
+	t, err := media.ExtractSubtitle(r, size, s.track)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.WithField("track", s.track).WithField("cues", len(t.Cues)).Info("extracted embedded subtitle")
+	return subconv.Write(t, s.format)
+}
+
+func (s *EmbeddedSub) convert(ctx context.Context, purge bool) ([]byte, error) {
+	o, err := s.orig.Get(ctx, purge)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get extracted subtitle")
+	}
+	return subconv.Convert(o, 0, s.format)
+}
+
+func (s *EmbeddedSub) Get(ctx context.Context, purge bool) ([]byte, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if purge {
+		s.inited = false
+	}
+	if s.inited {
+		return s.value, s.err
+	}
+	s.value, s.err = s.get(ctx, purge)
+	s.inited = true
+	return s.value, s.err
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/webtor-io/video-info/services/redis"
+	"github.com/webtor-io/video-info/services/retry"
+	"github.com/webtor-io/video-info/services/s3"
+	"github.com/webtor-io/video-info/services/subconv"
+)
+
+type EmbeddedSubsPool struct {
+	sm    sync.Map
+	s3    *s3.S3Storage
+	retry *retry.Policy
+}
+
+func NewEmbeddedSubsPool(s3 *s3.S3Storage, r *retry.Policy) *EmbeddedSubsPool {
+	return &EmbeddedSubsPool{
+		s3:    s3,
+		retry: r,
+	}
+}
+
+// Get returns text track of source container in specific format.
+func (s *EmbeddedSubsPool) Get(ctx context.Context, url string, source string, track int, format string, c *redis.Cache, purge bool, logger *logrus.Entry) ([]byte, error) {
+	var orig *EmbeddedSub
+	if format != subconv.FormatWebVTT {
+		orig = NewEmbeddedSub(url, source, track, subconv.FormatWebVTT, nil, c, s.s3, s.retry, logger)
+	}
+	key := source + "|" + strconv.Itoa(track) + format
+	v, loaded := s.sm.LoadOrStore(key, NewEmbeddedSub(url, source, track, format, orig, c, s.s3, s.retry, logger))
+	if !loaded {
+		defer s.sm.Delete(key)
+	}
+	return v.(*EmbeddedSub).Get(ctx, purge)
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/webtor-io/video-info/services/subconv"
+)
+
+type Format struct {
+	Ext         string
+	Name        string
+	ContentType string
+}
+
+var formats = []Format{
+	{Ext: "vtt", Name: subconv.FormatWebVTT, ContentType: "text/vtt;charset=utf-8"},
+	{Ext: "srt", Name: subconv.FormatSRT, ContentType: "application/x-subrip;charset=utf-8"},
+	{Ext: "ass", Name: subconv.FormatASS, ContentType: "text/x-ssa;charset=utf-8"},
+	{Ext: "ttml", Name: subconv.FormatTTML, ContentType: "application/ttml+xml;charset=utf-8"},
+}
+
+func getFormatByExt(ext string) *Format {
+	ext = strings.ToLower(ext)
+	for _, f := range formats {
+		if f.Ext == ext {
+			return &f
+		}
+	}
+	return nil
+}
@@ -4,19 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
-	"net/http"
 	"sync"
-	"time"
 
 	"github.com/webtor-io/video-info/services/redis"
+	"github.com/webtor-io/video-info/services/retry"
 
-	sh "github.com/jeffallen/seekinghttp"
 	"github.com/pkg/errors"
 )
 
 type Hash struct {
 	url    string
 	cache  *redis.Cache
+	retry  *retry.Policy
 	hash   uint64
 	size   int64
 	inited bool
@@ -24,8 +23,8 @@ type Hash struct {
 	mux    sync.Mutex
 }
 
-func NewHash(url string, c *redis.Cache) *Hash {
-	return &Hash{url: url, cache: c, inited: false}
+func NewHash(url string, c *redis.Cache, r *retry.Policy) *Hash {
+	return &Hash{url: url, cache: c, retry: r, inited: false}
 }
 
 func (s *Hash) get(ctx context.Context, purge bool) (uint64, int64, error) {
@@ -38,16 +37,7 @@ func (s *Hash) get(ctx context.Context, purge bool) (uint64, int64, error) {
 			return hash, size, nil
 		}
 	}
-	r := sh.New(s.url)
-	//myTransport := &http.Transport{
-	//	Dial: (&net.Dialer{
-	//		Timeout: 5 * time.Minute,
-	//	}).Dial,
-	//}
-	r.Client = &http.Client{
-		Timeout: 5 * time.Minute,
-		//Transport: myTransport,
-	}
+	r := newSourceRangeReader(ctx, s.url, s.retry)
 	hash, size, err := makeHash(r)
 	if err != nil {
 		return 0, 0, errors.Wrap(err, "failed to get hash")
@@ -78,7 +68,7 @@ const (
 	ChunkSize = 65536 // 64k
 )
 
-func makeHash(r *sh.SeekingHTTP) (uint64, int64, error) {
+func makeHash(r *rangeReader) (uint64, int64, error) {
 	var hash uint64 = 0
 	size, err := r.Size()
 	if err != nil {
@@ -113,8 +103,9 @@ func makeHash(r *sh.SeekingHTTP) (uint64, int64, error) {
 	return hash + uint64(size), size, nil
 }
 
-// Read a chunk of a file at `offset` so as to fill `buf`.
-func readChunk(r *sh.SeekingHTTP, offset int64, buf []byte) (err error) {
+// Read a chunk of a file at `offset` so as to fill `buf`. Range requests are
+// already retried by reader.
+func readChunk(r *rangeReader, offset int64, buf []byte) (err error) {
 	n, err := r.ReadAt(buf, offset)
 	if err != nil {
 		return errors.Wrapf(err, "failed to read chunk")
@@ -5,18 +5,20 @@ import (
 	"sync"
 
 	"github.com/webtor-io/video-info/services/redis"
+	"github.com/webtor-io/video-info/services/retry"
 )
 
 type HashPool struct {
-	sm sync.Map
+	sm    sync.Map
+	retry *retry.Policy
 }
 
-func NewHashPool() *HashPool {
-	return &HashPool{}
+func NewHashPool(r *retry.Policy) *HashPool {
+	return &HashPool{retry: r}
 }
 
 func (s *HashPool) Get(ctx context.Context, url string, c *redis.Cache, purge bool) (uint64, int64, error) {
-	v, loaded := s.sm.LoadOrStore(url, NewHash(url, c))
+	v, loaded := s.sm.LoadOrStore(url, NewHash(url, c, s.retry))
 	if !loaded {
 		defer s.sm.Delete(url)
 	}
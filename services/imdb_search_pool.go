@@ -2,28 +2,33 @@ package services
 
 import (
 	"context"
-	"github.com/webtor-io/video-info/services/osdb"
 	"strings"
-	"sync"
 
+	"github.com/pkg/errors"
+	"github.com/webtor-io/video-info/services/osdb"
 	"github.com/webtor-io/video-info/services/redis"
+	"github.com/webtor-io/video-info/services/s3"
 )
 
 type IMDBSearchPool struct {
-	sm       sync.Map
-	cl       *osdb.Client
-	hashPool *HashPool
+	searchPool
+}
+
+func NewIMDBSearchPool(st *s3.S3Storage) *IMDBSearchPool {
+	return &IMDBSearchPool{searchPool{s3: st}}
 }
 
-func NewIMDBSearchPool(cl *osdb.Client) *IMDBSearchPool {
-	return &IMDBSearchPool{cl: cl}
+func (s *IMDBSearchPool) Get(ctx context.Context, p Provider, imdbID string, languages []string, c *redis.Cache, purge bool) ([]osdb.Subtitle, error) {
+	imdbID = normalizeIMDBID(imdbID)
+	return s.get(ctx, p, imdbID, languages, c, purge, func(ctx context.Context, _ bool) ([]osdb.Subtitle, error) {
+		subtitles, err := p.SearchByIMDB(ctx, imdbID, languages)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get subtitles")
+		}
+		return subtitles, nil
+	})
 }
 
-func (s *IMDBSearchPool) Get(ctx context.Context, imdbID string, c *redis.Cache, purge bool) ([]osdb.Subtitle, error) {
-	imdbID = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(imdbID), "tt"), "0")
-	v, loaded := s.sm.LoadOrStore(imdbID, NewIMDBSearch(imdbID, s.cl, c))
-	if !loaded {
-		defer s.sm.Delete(imdbID)
-	}
-	return v.(*IMDBSearch).Get(ctx, purge)
+func normalizeIMDBID(imdbID string) string {
+	return strings.TrimLeft(strings.TrimPrefix(strings.ToLower(imdbID), "tt"), "0")
 }
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/webtor-io/video-info/services/osdb"
+)
+
+// getLanguages returns normalized and sorted set of languages requested
+// with languages query parameter.
+func getLanguages(r *http.Request) []string {
+	var res []string
+	for _, l := range strings.Split(r.URL.Query().Get("languages"), ",") {
+		l = strings.ToLower(strings.TrimSpace(l))
+		if l == "" || containsString(res, l) {
+			continue
+		}
+		res = append(res, l)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// getAcceptLanguages returns languages from Accept-Language header ordered
+// by their quality value.
+func getAcceptLanguages(r *http.Request) []string {
+	type lq struct {
+		lang string
+		q    float64
+	}
+	var lqs []lq
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		lqs = append(lqs, lq{lang: tag, q: q})
+	}
+	sort.SliceStable(lqs, func(i, j int) bool {
+		return lqs[i].q > lqs[j].q
+	})
+	var res []string
+	for _, v := range lqs {
+		if !containsString(res, v.lang) {
+			res = append(res, v.lang)
+		}
+	}
+	return res
+}
+
+// languageRank returns position of the best matching language from langs,
+// exact matches rank before primary subtag matches (e.g. "pt" for "pt-br").
+// Returns -1 if nothing matches.
+func languageRank(lang string, langs []string) int {
+	lang = strings.ToLower(lang)
+	primary, _, _ := strings.Cut(lang, "-")
+	for i, l := range langs {
+		if l == lang {
+			return i
+		}
+	}
+	for i, l := range langs {
+		p, _, _ := strings.Cut(l, "-")
+		if p == primary {
+			return len(langs) + i
+		}
+	}
+	return -1
+}
+
+func filterByLanguages(subs []osdb.Subtitle, langs []string) []osdb.Subtitle {
+	if len(langs) == 0 {
+		return subs
+	}
+	var res []osdb.Subtitle
+	for _, s := range subs {
+		if languageRank(s.Attributes.Language, langs) != -1 {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// orderByLanguages moves subtitles in preferred languages to the top
+// keeping original order inside each language.
+func orderByLanguages(subs []osdb.Subtitle, langs []string) []osdb.Subtitle {
+	if len(langs) == 0 {
+		return subs
+	}
+	rank := func(s osdb.Subtitle) int {
+		r := languageRank(s.Attributes.Language, langs)
+		if r == -1 {
+			return 2 * len(langs)
+		}
+		return r
+	}
+	res := make([]osdb.Subtitle, len(subs))
+	copy(res, subs)
+	sort.SliceStable(res, func(i, j int) bool {
+		return rank(res[i]) < rank(res[j])
+	})
+	return res
+}
+
+// iso6392 maps ISO 639-2 codes used by containers to ISO 639-1 ones.
+var iso6392 = map[string]string{
+	"alb": "sq", "ara": "ar", "arm": "hy", "baq": "eu", "bel": "be", "ben": "bn",
+	"bos": "bs", "bul": "bg", "bur": "my", "cat": "ca", "ces": "cs", "chi": "zh",
+	"cym": "cy", "cze": "cs", "dan": "da", "deu": "de", "dut": "nl", "ell": "el",
+	"eng": "en", "est": "et", "eus": "eu", "fas": "fa", "fin": "fi", "fra": "fr",
+	"fre": "fr", "geo": "ka", "ger": "de", "gle": "ga", "glg": "gl", "gre": "el",
+	"heb": "he", "hin": "hi", "hrv": "hr", "hun": "hu", "hye": "hy", "ice": "is",
+	"ind": "id", "isl": "is", "ita": "it", "jpn": "ja", "kat": "ka", "kaz": "kk",
+	"kor": "ko", "lav": "lv", "lit": "lt", "mac": "mk", "may": "ms", "mkd": "mk",
+	"mon": "mn", "msa": "ms", "mya": "my", "nld": "nl", "nob": "nb", "nor": "no",
+	"per": "fa", "pol": "pl", "por": "pt", "ron": "ro", "rum": "ro", "rus": "ru",
+	"slk": "sk", "slo": "sk", "slv": "sl", "spa": "es", "sqi": "sq", "srp": "sr",
+	"swe": "sv", "tam": "ta", "tel": "te", "tha": "th", "tur": "tr", "ukr": "uk",
+	"urd": "ur", "vie": "vi", "wel": "cy", "zho": "zh",
+}
+
+// normalizeLanguage converts container language (ISO 639-2 or BCP 47 tag)
+// to the form used by OpenSubtitles. Undetermined language becomes empty.
+func normalizeLanguage(lang string) string {
+	lang = strings.ToLower(lang)
+	if lang == "und" || lang == "" {
+		return ""
+	}
+	primary, rest, _ := strings.Cut(lang, "-")
+	if l, ok := iso6392[primary]; ok {
+		primary = l
+	}
+	if rest != "" {
+		return primary + "-" + rest
+	}
+	return primary
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,466 @@
+package local
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/webtor-io/video-info/services/release"
+)
+
+const ManifestName = "manifest.json"
+
+var (
+	ErrNotFound = errors.New("subtitle not found")
+)
+
+var (
+	hashRe     = regexp.MustCompile(`^[0-9a-fA-F]{16}$`)
+	imdbRe     = regexp.MustCompile(`^(?i)tt\d+$`)
+	languageRe = regexp.MustCompile(`^(?i)[a-z]{2}(?:[-_][a-z]{2})?$`)
+)
+
+var extensions = map[string]bool{
+	".srt": true,
+	".sub": true,
+	".ass": true,
+	".ssa": true,
+	".vtt": true,
+	".txt": true,
+}
+
+// Entry is single subtitle file of the archive
+type Entry struct {
+	ID              int
+	Path            string
+	Hash            uint64
+	Size            int64
+	IMDBID          string
+	Language        string
+	Release         string
+	Title           string
+	Year            int
+	Season          int
+	Episode         int
+	HearingImpaired bool
+	Fps             float64
+}
+
+// manifestEntry describes file in manifest.json, it overrides data
+// guessed from the file path. File is relative to the manifest directory.
+type manifestEntry struct {
+	File            string  `json:"file"`
+	Hash            string  `json:"hash"`
+	Size            int64   `json:"size"`
+	IMDBID          string  `json:"imdb_id"`
+	Language        string  `json:"language"`
+	Release         string  `json:"release"`
+	Title           string  `json:"title"`
+	Year            int     `json:"year"`
+	Season          int     `json:"season"`
+	Episode         int     `json:"episode"`
+	HearingImpaired bool    `json:"hearing_impaired"`
+	Fps             float64 `json:"fps"`
+}
+
+// Index keeps subtitles of the directory in memory. The directory is
+// rescanned in background at most once per interval and reindexed only
+// when some file was added, removed or modified. Lookups are served from
+// the previous snapshot while rescan is running.
+type Index struct {
+	root     string
+	interval time.Duration
+	checked  time.Time
+	scanning bool
+	data     *snapshot
+	mux      sync.Mutex
+}
+
+// snapshot is index of the directory state, it is never modified after
+// it is built.
+type snapshot struct {
+	signature uint64
+	entries   []Entry
+	byHash    map[uint64][]int
+	byIMDB    map[string][]int
+	byID      map[int]int
+}
+
+func NewIndex(root string, interval time.Duration) *Index {
+	return &Index{
+		root:     root,
+		interval: interval,
+	}
+}
+
+type file struct {
+	path string
+	info fs.FileInfo
+}
+
+func (s *Index) walk() ([]file, uint64, error) {
+	var files []file
+	h := fnv.New64a()
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if name != ManifestName && !extensions[strings.ToLower(filepath.Ext(name))] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		files = append(files, file{path: rel, info: info})
+		h.Write([]byte(rel + "|" + strconv.FormatInt(info.ModTime().UnixNano(), 10) + "|" + strconv.FormatInt(info.Size(), 10) + "\n"))
+		return nil
+	})
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to walk directory %v", s.root)
+	}
+	return files, h.Sum64(), nil
+}
+
+// get returns current snapshot and starts background rescan when interval
+// is over. There is nothing to serve before the first scan, so it is waited
+// for.
+func (s *Index) get() (*snapshot, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.data == nil {
+		data, err := s.scan(nil)
+		if err != nil {
+			return nil, err
+		}
+		s.data = data
+		s.checked = time.Now()
+		return data, nil
+	}
+	if !s.scanning && time.Since(s.checked) >= s.interval {
+		s.scanning = true
+		go s.rescan(s.data)
+	}
+	return s.data, nil
+}
+
+func (s *Index) rescan(prev *snapshot) {
+	data, err := s.scan(prev)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.scanning = false
+	s.checked = time.Now()
+	if err != nil {
+		log.WithError(err).WithField("dir", s.root).Warn("failed to rescan local subtitles")
+		return
+	}
+	s.data = data
+}
+
+// scan walks the directory and builds new snapshot, prev is kept if
+// nothing has changed.
+func (s *Index) scan(prev *snapshot) (*snapshot, error) {
+	files, sig, err := s.walk()
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil && sig == prev.signature {
+		return prev, nil
+	}
+	data := s.build(files)
+	data.signature = sig
+	log.WithField("dir", s.root).WithField("subtitles", len(data.entries)).Info("local subtitles indexed")
+	return data, nil
+}
+
+func (s *Index) build(files []file) *snapshot {
+	entries := map[string]*Entry{}
+	var manifests []string
+	for _, f := range files {
+		if filepath.Base(f.path) == ManifestName {
+			manifests = append(manifests, f.path)
+			continue
+		}
+		entries[f.path] = parsePath(f.path)
+	}
+	for _, m := range manifests {
+		mes, err := s.readManifest(m)
+		if err != nil {
+			log.WithError(err).WithField("manifest", m).Warn("failed to read manifest")
+			continue
+		}
+		dir := filepath.ToSlash(filepath.Dir(m))
+		for _, me := range mes {
+			p := filepath.ToSlash(filepath.Clean(filepath.Join(dir, me.File)))
+			if e, ok := entries[p]; ok {
+				me.apply(e)
+			}
+		}
+	}
+	d := &snapshot{
+		entries: make([]Entry, 0, len(entries)),
+		byHash:  map[uint64][]int{},
+		byIMDB:  map[string][]int{},
+		byID:    map[int]int{},
+	}
+	for _, f := range files {
+		e, ok := entries[f.path]
+		if !ok {
+			continue
+		}
+		// files are walked in lexical order, so probed ids are stable
+		for n := 1; ; n++ {
+			if _, ok := d.byID[e.ID]; !ok {
+				break
+			}
+			log.WithField("path", e.Path).WithField("id", e.ID).Warn("local subtitle id collision")
+			e.ID = makeID(e.Path, n)
+		}
+		i := len(d.entries)
+		d.entries = append(d.entries, *e)
+		d.byID[e.ID] = i
+		if e.Hash != 0 {
+			d.byHash[e.Hash] = append(d.byHash[e.Hash], i)
+		}
+		if e.IMDBID != "" {
+			d.byIMDB[e.IMDBID] = append(d.byIMDB[e.IMDBID], i)
+		}
+	}
+	return d
+}
+
+func (s *Index) readManifest(p string) ([]manifestEntry, error) {
+	data, err := os.ReadFile(filepath.Join(s.root, filepath.FromSlash(p)))
+	if err != nil {
+		return nil, err
+	}
+	var res []manifestEntry
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal manifest")
+	}
+	return res, nil
+}
+
+func (s *manifestEntry) apply(e *Entry) {
+	if h, err := strconv.ParseUint(s.Hash, 16, 64); err == nil && s.Hash != "" {
+		e.Hash = h
+	}
+	if s.Size != 0 {
+		e.Size = s.Size
+	}
+	if s.IMDBID != "" {
+		e.IMDBID = normalizeIMDBID(s.IMDBID)
+	}
+	if s.Language != "" {
+		e.Language = normalizeLanguage(s.Language)
+	}
+	if s.Release != "" {
+		e.Release = s.Release
+	}
+	if s.Title != "" {
+		e.Title = s.Title
+	}
+	if s.Year != 0 {
+		e.Year = s.Year
+	}
+	if s.Season != 0 {
+		e.Season = s.Season
+	}
+	if s.Episode != 0 {
+		e.Episode = s.Episode
+	}
+	if s.HearingImpaired {
+		e.HearingImpaired = true
+	}
+	if s.Fps != 0 {
+		e.Fps = s.Fps
+	}
+}
+
+// parsePath guesses subtitle data from its path, e.g.
+// tt0111161/8e245d9679d31e12.en.srt or Show.S01E02.720p-GRP.pt-br.srt.
+// Hash and IMDB id are taken from the nearest path element having them.
+func parsePath(p string) *Entry {
+	els := strings.Split(p, "/")
+	name := els[len(els)-1]
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	e := &Entry{
+		ID:   makeID(p, 0),
+		Path: p,
+	}
+	tokens := strings.Split(base, ".")
+	if len(tokens) > 1 && languageRe.MatchString(tokens[len(tokens)-1]) {
+		e.Language = normalizeLanguage(tokens[len(tokens)-1])
+		tokens = tokens[:len(tokens)-1]
+	}
+	var rest []string
+	for _, t := range tokens {
+		if !parseToken(e, t) {
+			rest = append(rest, t)
+		}
+	}
+	for i := len(els) - 2; i >= 0; i-- {
+		for _, t := range strings.Split(els[i], ".") {
+			parseToken(e, t)
+		}
+	}
+	// plain file names like "sub.en.srt" take release name of the directory
+	e.Release = strings.Join(rest, ".")
+	if !hasReleaseTokens(e.Release) {
+		for i := len(els) - 2; i >= 0; i-- {
+			if hasReleaseTokens(els[i]) {
+				e.Release = els[i]
+				break
+			}
+		}
+	}
+	dir := strings.Join(els[:len(els)-1], "/")
+	ri := release.Parse(strings.TrimPrefix(dir+"/"+strings.Join(rest, ".")+filepath.Ext(name), "/"))
+	if !hashRe.MatchString(ri.Title) && !imdbRe.MatchString(ri.Title) {
+		e.Title = ri.Title
+	}
+	e.Year = ri.Year
+	e.Season = ri.Season
+	e.Episode = ri.Episode
+	return e
+}
+
+func hasReleaseTokens(name string) bool {
+	i := release.Parse(name)
+	return i.Year != 0 || i.Season != 0 || i.Resolution != "" || i.Source != "" || i.Codec != "" || i.Group != ""
+}
+
+// parseToken fills hash or IMDB id if the token is one of them and they
+// are still unknown.
+func parseToken(e *Entry, t string) bool {
+	if hashRe.MatchString(t) {
+		if e.Hash == 0 {
+			e.Hash, _ = strconv.ParseUint(t, 16, 64)
+		}
+		return true
+	}
+	if imdbRe.MatchString(t) {
+		if e.IMDBID == "" {
+			e.IMDBID = normalizeIMDBID(t)
+		}
+		return true
+	}
+	return false
+}
+
+// makeID hashes path to stable id, n > 0 probes the next id on collision.
+func makeID(p string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(p))
+	if n > 0 {
+		h.Write([]byte("#" + strconv.Itoa(n)))
+	}
+	return int(h.Sum32() & 0x7fffffff)
+}
+
+func normalizeIMDBID(id string) string {
+	return strings.TrimLeft(strings.TrimPrefix(strings.ToLower(id), "tt"), "0")
+}
+
+func normalizeLanguage(l string) string {
+	return strings.ReplaceAll(strings.ToLower(l), "_", "-")
+}
+
+func normalizeTitle(t string) string {
+	return strings.Join(release.Tokens(t), " ")
+}
+
+func (s *snapshot) collect(ids []int) []Entry {
+	res := make([]Entry, 0, len(ids))
+	for _, i := range ids {
+		res = append(res, s.entries[i])
+	}
+	return res
+}
+
+// ByHash returns subtitles made for the video with specific hash. Entries
+// with known size must match it too.
+func (s *Index) ByHash(hash uint64, size int64) ([]Entry, error) {
+	d, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	var res []Entry
+	for _, e := range d.collect(d.byHash[hash]) {
+		if e.Size == 0 || size == 0 || e.Size == size {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (s *Index) ByIMDB(id string) ([]Entry, error) {
+	d, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return d.collect(d.byIMDB[normalizeIMDBID(id)]), nil
+}
+
+// ByQuery returns subtitles with the same normalized title, year, season
+// and episode are compared only when set in both query and entry.
+func (s *Index) ByQuery(title string, year int, season int, episode int) ([]Entry, error) {
+	d, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	title = normalizeTitle(title)
+	if title == "" {
+		return nil, nil
+	}
+	match := func(a int, b int) bool {
+		return a == 0 || b == 0 || a == b
+	}
+	var res []Entry
+	for _, e := range d.entries {
+		if normalizeTitle(e.Title) != title {
+			continue
+		}
+		if match(year, e.Year) && match(season, e.Season) && match(episode, e.Episode) {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+// Read returns content of subtitle file by its id.
+func (s *Index) Read(id int) ([]byte, error) {
+	d, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	i, ok := d.byID[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	p := d.entries[i].Path
+	data, err := os.ReadFile(filepath.Join(s.root, filepath.FromSlash(p)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read subtitle file %v", p)
+	}
+	return data, nil
+}
@@ -0,0 +1,221 @@
+package local
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want Entry
+	}{
+		{
+			path: "tt0111161/8e245d9679d31e12.en.srt",
+			want: Entry{Hash: 0x8e245d9679d31e12, IMDBID: "111161", Language: "en"},
+		},
+		{
+			path: "Show.S01E02.720p-GRP.pt-br.srt",
+			want: Entry{Language: "pt-br", Release: "Show.S01E02.720p-GRP", Title: "Show", Season: 1, Episode: 2},
+		},
+		{
+			path: "The.Movie.2010.1080p.BluRay.x264-GRP/sub.en_US.srt",
+			want: Entry{Language: "en-us", Release: "The.Movie.2010.1080p.BluRay.x264-GRP", Title: "The Movie", Year: 2010},
+		},
+		{
+			path: "Movie/tt0111161.ru.srt",
+			want: Entry{IMDBID: "111161", Language: "ru", Title: "Movie"},
+		},
+		{
+			path: "Show/Season 1/Show.S01E03.srt",
+			want: Entry{Release: "Show.S01E03", Title: "Show", Season: 1, Episode: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := parsePath(tt.path)
+			tt.want.ID = makeID(tt.path, 0)
+			tt.want.Path = tt.path
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("parsePath() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestApply(t *testing.T) {
+	e := parsePath("a/sub.srt")
+	me := &manifestEntry{
+		Hash:            "8e245d9679d31e12",
+		Size:            1024,
+		IMDBID:          "tt0111161",
+		Language:        "PT_BR",
+		Title:           "Title",
+		Year:            1994,
+		HearingImpaired: true,
+		Fps:             23.976,
+	}
+	me.apply(e)
+	want := &Entry{
+		ID:              e.ID,
+		Path:            "a/sub.srt",
+		Hash:            0x8e245d9679d31e12,
+		Size:            1024,
+		IMDBID:          "111161",
+		Language:        "pt-br",
+		Release:         "sub",
+		Title:           "Title",
+		Year:            1994,
+		HearingImpaired: true,
+		Fps:             23.976,
+	}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("apply() = %+v, want %+v", e, want)
+	}
+}
+
+func TestNormalizeIMDBID(t *testing.T) {
+	for id, want := range map[string]string{"tt0111161": "111161", "TT111161": "111161", "0111161": "111161"} {
+		if got := normalizeIMDBID(id); got != want {
+			t.Errorf("normalizeIMDBID(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for p, d := range files {
+		p = filepath.Join(root, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(d), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func paths(es []Entry) []string {
+	var res []string
+	for _, e := range es {
+		res = append(res, e.Path)
+	}
+	return res
+}
+
+func TestIndexLookup(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"tt0111161/8e245d9679d31e12.en.srt":   "en",
+		"tt0111161/8e245d9679d31e12.ru.srt":   "ru",
+		"The.Movie.2010.1080p-GRP/sub.en.srt": "movie",
+		"Show.S01E02.720p-GRP.en.srt":         "episode",
+		"sized/sub.en.srt":                    "sized",
+		"sized/" + ManifestName:               `[{"file": "sub.en.srt", "hash": "00000000000000ff", "size": 100, "imdb_id": "tt1"}]`,
+		"broken/" + ManifestName:              `{`,
+		"The.Movie.2010.1080p-GRP/movie.nfo":  "",
+	})
+	s := NewIndex(root, time.Hour)
+	tests := []struct {
+		name string
+		get  func() ([]Entry, error)
+		want []string
+	}{
+		{
+			name: "hash",
+			get:  func() ([]Entry, error) { return s.ByHash(0x8e245d9679d31e12, 0) },
+			want: []string{"tt0111161/8e245d9679d31e12.en.srt", "tt0111161/8e245d9679d31e12.ru.srt"},
+		},
+		{
+			name: "hash and size from manifest",
+			get:  func() ([]Entry, error) { return s.ByHash(0xff, 100) },
+			want: []string{"sized/sub.en.srt"},
+		},
+		{
+			name: "hash with other size",
+			get:  func() ([]Entry, error) { return s.ByHash(0xff, 200) },
+		},
+		{
+			name: "imdb",
+			get:  func() ([]Entry, error) { return s.ByIMDB("tt0111161") },
+			want: []string{"tt0111161/8e245d9679d31e12.en.srt", "tt0111161/8e245d9679d31e12.ru.srt"},
+		},
+		{
+			name: "imdb from manifest",
+			get:  func() ([]Entry, error) { return s.ByIMDB("tt0000001") },
+			want: []string{"sized/sub.en.srt"},
+		},
+		{
+			name: "query",
+			get:  func() ([]Entry, error) { return s.ByQuery("the movie", 2010, 0, 0) },
+			want: []string{"The.Movie.2010.1080p-GRP/sub.en.srt"},
+		},
+		{
+			name: "query with other year",
+			get:  func() ([]Entry, error) { return s.ByQuery("The Movie", 2011, 0, 0) },
+		},
+		{
+			name: "episode query",
+			get:  func() ([]Entry, error) { return s.ByQuery("Show", 0, 1, 2) },
+			want: []string{"Show.S01E02.720p-GRP.en.srt"},
+		},
+		{
+			name: "empty query",
+			get:  func() ([]Entry, error) { return s.ByQuery("...", 0, 0, 0) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get()
+			if err != nil {
+				t.Fatalf("lookup error = %v", err)
+			}
+			if !reflect.DeepEqual(paths(got), tt.want) {
+				t.Errorf("lookup = %v, want %v", paths(got), tt.want)
+			}
+		})
+	}
+	d, err := s.Read(makeID("tt0111161/8e245d9679d31e12.ru.srt", 0))
+	if err != nil || string(d) != "ru" {
+		t.Errorf("Read() = %q, %v, want %q", d, err, "ru")
+	}
+	if _, err := s.Read(0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestIndexRescan(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"tt1/sub.en.srt": "en"})
+	s := NewIndex(root, 0)
+	if got, err := s.ByIMDB("tt1"); err != nil || len(got) != 1 {
+		t.Fatalf("ByIMDB() = %v, %v, want single entry", got, err)
+	}
+	writeFiles(t, root, map[string]string{"tt1/sub.ru.srt": "ru"})
+	// rescan runs in background, stale snapshot is served meanwhile
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := s.ByIMDB("tt1")
+		if err != nil {
+			t.Fatalf("ByIMDB() error = %v", err)
+		}
+		if len(got) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ByIMDB() = %v, want new file after rescan", paths(got))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIndexMissingDir(t *testing.T) {
+	s := NewIndex(filepath.Join(t.TempDir(), "missing"), time.Hour)
+	if _, err := s.ByIMDB("tt1"); err == nil {
+		t.Errorf("ByIMDB() error = nil, want error")
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/webtor-io/video-info/services/local"
+	"github.com/webtor-io/video-info/services/osdb"
+)
+
+const (
+	LocalProviderName        = "local"
+	LocalSubtitlesDirFlag    = "local-subtitles-dir"
+	LocalSubtitlesRescanFlag = "local-subtitles-rescan-interval"
+)
+
+// LocalProvider serves subtitles from directory indexed by movie hash and
+// IMDB id, see local.Index for naming conventions.
+type LocalProvider struct {
+	index *local.Index
+}
+
+func RegisterLocalProviderFlags(f []cli.Flag) []cli.Flag {
+	return append(f,
+		cli.StringFlag{
+			Name:   LocalSubtitlesDirFlag,
+			Usage:  "directory with local subtitles",
+			Value:  "",
+			EnvVar: "LOCAL_SUBTITLES_DIR",
+		},
+		cli.DurationFlag{
+			Name:   LocalSubtitlesRescanFlag,
+			Usage:  "how often to check local subtitles directory for changes",
+			Value:  time.Minute,
+			EnvVar: "LOCAL_SUBTITLES_RESCAN_INTERVAL",
+		},
+	)
+}
+
+func NewLocalProvider(c *cli.Context) *LocalProvider {
+	if c.String(LocalSubtitlesDirFlag) == "" {
+		return nil
+	}
+	return &LocalProvider{
+		index: local.NewIndex(c.String(LocalSubtitlesDirFlag), c.Duration(LocalSubtitlesRescanFlag)),
+	}
+}
+
+func (s *LocalProvider) Name() string {
+	return LocalProviderName
+}
+
+func (s *LocalProvider) Volatile() bool {
+	return true
+}
+
+func (s *LocalProvider) makeSubtitles(entries []local.Entry, languages []string, hashMatch bool) []osdb.Subtitle {
+	res := make([]osdb.Subtitle, 0, len(entries))
+	for _, e := range entries {
+		sub := osdb.Subtitle{
+			Id:   strconv.Itoa(e.ID),
+			Type: "subtitle",
+		}
+		a := &sub.Attributes
+		a.SubtitleId = sub.Id
+		a.Language = e.Language
+		a.Release = e.Release
+		a.HearingImpaired = e.HearingImpaired
+		a.Fps = e.Fps
+		a.FromTrusted = true
+		a.MoviehashMatch = hashMatch
+		a.FeatureDetails.Title = e.Title
+		a.FeatureDetails.Year = e.Year
+		a.FeatureDetails.ImdbId, _ = strconv.Atoi(e.IMDBID)
+		a.Files = []osdb.SubtitleFile{{
+			FileId:   e.ID,
+			CdNumber: 1,
+			FileName: path.Base(e.Path),
+		}}
+		res = append(res, sub)
+	}
+	return filterByLanguages(res, languages)
+}
+
+func (s *LocalProvider) SearchByHash(_ context.Context, hash uint64, size int64, languages []string) ([]osdb.Subtitle, error) {
+	entries, err := s.index.ByHash(hash, size)
+	if err != nil {
+		return nil, err
+	}
+	return s.makeSubtitles(entries, languages, true), nil
+}
+
+func (s *LocalProvider) SearchByIMDB(_ context.Context, imdbID string, languages []string) ([]osdb.Subtitle, error) {
+	entries, err := s.index.ByIMDB(imdbID)
+	if err != nil {
+		return nil, err
+	}
+	return s.makeSubtitles(entries, languages, false), nil
+}
+
+func (s *LocalProvider) SearchByQuery(_ context.Context, q osdb.Query, languages []string) ([]osdb.Subtitle, error) {
+	entries, err := s.index.ByQuery(q.Query, q.Year, q.Season, q.Episode)
+	if err != nil {
+		return nil, err
+	}
+	return s.makeSubtitles(entries, languages, false), nil
+}
+
+func (s *LocalProvider) Download(_ context.Context, _ *osdb.Subtitle, fileID int) ([]byte, error) {
+	return s.index.Read(fileID)
+}
@@ -0,0 +1,162 @@
+package media
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	idEditionEntry       = 0x45B9
+	idEditionFlagHidden  = 0x45BD
+	idEditionFlagDefault = 0x45DB
+	idChapterAtom        = 0xB6
+	idChapterTimeStart   = 0x91
+	idChapterTimeEnd     = 0x92
+	idChapterFlagHidden  = 0x98
+	idChapterDisplay     = 0x80
+	idChapString         = 0x85
+)
+
+// Chapter times are in seconds like Info.Duration.
+type Chapter struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Title string  `json:"title"`
+}
+
+// normalizeChapters sorts chapters and fills missing end times with start
+// of the next chapter or with total duration for the last one.
+func normalizeChapters(cs []Chapter, duration float64) []Chapter {
+	sort.SliceStable(cs, func(i, j int) bool {
+		return cs[i].Start < cs[j].Start
+	})
+	for i := range cs {
+		if cs[i].End > cs[i].Start {
+			continue
+		}
+		if i+1 < len(cs) {
+			cs[i].End = cs[i+1].Start
+		} else {
+			cs[i].End = duration
+		}
+	}
+	return cs
+}
+
+// chapters reads chapter atoms of default edition, nested chapters are
+// ignored.
+func (m *matroska) chapters() ([]Chapter, error) {
+	d, err := m.element(idChapters)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	var edition []byte
+	for _, e := range children(d) {
+		if e.id != idEditionEntry {
+			continue
+		}
+		var def, hidden bool
+		for _, ee := range children(e.data) {
+			switch ee.id {
+			case idEditionFlagDefault:
+				def = readUint(ee.data) == 1
+			case idEditionFlagHidden:
+				hidden = readUint(ee.data) == 1
+			}
+		}
+		if hidden {
+			continue
+		}
+		if edition == nil || def {
+			edition = e.data
+		}
+		if def {
+			break
+		}
+	}
+	var res []Chapter
+	for _, a := range children(edition) {
+		if a.id != idChapterAtom {
+			continue
+		}
+		c := Chapter{}
+		hidden := false
+		for _, ae := range children(a.data) {
+			switch ae.id {
+			case idChapterTimeStart:
+				c.Start = float64(readUint(ae.data)) / 1e9
+			case idChapterTimeEnd:
+				c.End = float64(readUint(ae.data)) / 1e9
+			case idChapterFlagHidden:
+				hidden = readUint(ae.data) == 1
+			case idChapterDisplay:
+				if c.Title == "" {
+					c.Title = readString(findElement(children(ae.data), idChapString))
+				}
+			}
+		}
+		if !hidden {
+			res = append(res, c)
+		}
+	}
+	return normalizeChapters(res, m.duration), nil
+}
+
+// chapters reads QuickTime chapter track if there is one, Nero chpl box
+// otherwise.
+func (m *mp4) chapters() ([]Chapter, error) {
+	var duration float64
+	if m.timescale > 0 {
+		duration = float64(m.duration) / float64(m.timescale)
+	}
+	for id := range m.chapterTracks() {
+		t := m.track(id)
+		if t == nil || t.timescale == 0 {
+			continue
+		}
+		samples, err := t.sampleTable()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read chapter track")
+		}
+		var res []Chapter
+		err = m.readSamples(samples, func(s *mp4Sample, d []byte) {
+			res = append(res, Chapter{
+				Start: float64(s.start) / float64(t.timescale),
+				End:   float64(s.start+s.duration) / float64(t.timescale),
+				Title: tx3gText(d),
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		return normalizeChapters(res, duration), nil
+	}
+	d := findBox(boxes(m.udta), "chpl")
+	if len(d) < 5 {
+		return nil, nil
+	}
+	p := 4
+	if d[0] == 1 {
+		p += 4
+	}
+	if p >= len(d) {
+		return nil, nil
+	}
+	n := int(d[p])
+	p++
+	var res []Chapter
+	for i := 0; i < n && p+9 <= len(d); i++ {
+		// start is in 100ns units
+		start := float64(binary.BigEndian.Uint64(d[p:])) / 1e7
+		l := int(d[p+8])
+		p += 9
+		if p+l > len(d) {
+			break
+		}
+		res = append(res, Chapter{Start: start, Title: string(d[p : p+l])})
+		p += l
+	}
+	return normalizeChapters(res, duration), nil
+}
@@ -0,0 +1,132 @@
+package media
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const unknownSize = -1
+
+type element struct {
+	id   uint32
+	data []byte
+}
+
+// readVint reads EBML variable size integer from b. If keepMarker is set
+// length marker is left in the value (used for element ids).
+func readVint(b []byte, keepMarker bool) (uint64, int, error) {
+	if len(b) == 0 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	l := 1
+	mask := byte(0x80)
+	for l <= 8 && b[0]&mask == 0 {
+		mask >>= 1
+		l++
+	}
+	if l > 8 {
+		return 0, 0, errors.New("invalid vint")
+	}
+	if len(b) < l {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	v := uint64(b[0])
+	if !keepMarker {
+		v &= uint64(mask - 1)
+	}
+	for i := 1; i < l; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, l, nil
+}
+
+// readHeader reads element id and size from b, returns header length.
+// Size is unknownSize for elements of unknown size.
+func readHeader(b []byte) (uint32, int64, int, error) {
+	id, il, err := readVint(b, true)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	size, sl, err := readVint(b[il:], false)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if size == (1<<(7*uint(sl)))-1 {
+		return uint32(id), unknownSize, il + sl, nil
+	}
+	return uint32(id), int64(size), il + sl, nil
+}
+
+// readHeaderAt reads element header at off.
+func readHeaderAt(r io.ReaderAt, off int64) (uint32, int64, int, error) {
+	buf := make([]byte, 12)
+	n, err := r.ReadAt(buf, off)
+	if n == 0 {
+		return 0, 0, 0, errors.Wrapf(err, "failed to read element header at %v", off)
+	}
+	return readHeader(buf[:n])
+}
+
+// children splits master element data into child elements.
+func children(b []byte) []element {
+	var res []element
+	for len(b) > 0 {
+		id, size, hl, err := readHeader(b)
+		if err != nil || size == unknownSize || int64(len(b)-hl) < size {
+			break
+		}
+		res = append(res, element{id: id, data: b[hl : hl+int(size)]})
+		b = b[hl+int(size):]
+	}
+	return res
+}
+
+func findElement(els []element, id uint32) []byte {
+	for _, e := range els {
+		if e.id == id {
+			return e.data
+		}
+	}
+	return nil
+}
+
+func readUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func readInt(b []byte) int64 {
+	if len(b) == 0 {
+		return 0
+	}
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+func readFloat(b []byte) float64 {
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func readString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
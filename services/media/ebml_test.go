@@ -0,0 +1,95 @@
+package media
+
+import (
+	"testing"
+)
+
+func TestReadVint(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		keepMarker bool
+		want       uint64
+		length     int
+		err        bool
+	}{
+		{name: "1 byte", data: []byte{0x81}, want: 1, length: 1},
+		{name: "2 bytes", data: []byte{0x40, 0x02}, want: 2, length: 2},
+		{name: "8 bytes", data: []byte{0x01, 0, 0, 0, 0, 0, 0x01, 0x00}, want: 256, length: 8},
+		{name: "id keeps marker", data: []byte{0x1A, 0x45, 0xDF, 0xA3}, keepMarker: true, want: 0x1A45DFA3, length: 4},
+		{name: "invalid", data: []byte{0x00}, err: true},
+		{name: "truncated", data: []byte{0x20, 0x01}, err: true},
+		{name: "empty", data: nil, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, l, err := readVint(tt.data, tt.keepMarker)
+			if (err != nil) != tt.err {
+				t.Fatalf("readVint() error = %v, want error %v", err, tt.err)
+			}
+			if !tt.err && (v != tt.want || l != tt.length) {
+				t.Errorf("readVint() = %v, %v, want %v, %v", v, l, tt.want, tt.length)
+			}
+		})
+	}
+}
+
+func TestReadHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		id   uint32
+		size int64
+		hl   int
+	}{
+		{name: "known size", data: []byte{0xAE, 0x85}, id: idTrackEntry, size: 5, hl: 2},
+		{name: "8 byte size", data: ebml(idSegment, make([]byte, 3)), id: idSegment, size: 3, hl: 12},
+		{name: "unknown 1 byte size", data: []byte{0x1F, 0x43, 0xB6, 0x75, 0xFF}, id: idCluster, size: unknownSize, hl: 5},
+		{name: "unknown 8 byte size", data: ebmlUnknown(idSegment), id: idSegment, size: unknownSize, hl: 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, size, hl, err := readHeader(tt.data)
+			if err != nil {
+				t.Fatalf("readHeader() error = %v", err)
+			}
+			if id != tt.id || size != tt.size || hl != tt.hl {
+				t.Errorf("readHeader() = %x, %v, %v, want %x, %v, %v", id, size, hl, tt.id, tt.size, tt.hl)
+			}
+		})
+	}
+}
+
+func TestChildren(t *testing.T) {
+	d := append(ebml(idTrackNumber, []byte{1}), ebml(idCodecID, []byte("A_AAC"))...)
+	// truncated and unknown size children stop parsing
+	d = append(d, ebmlUnknown(idVideo)...)
+	els := children(d)
+	if len(els) != 2 {
+		t.Fatalf("children() = %v elements, want 2", len(els))
+	}
+	if readUint(findElement(els, idTrackNumber)) != 1 || readString(findElement(els, idCodecID)) != "A_AAC" {
+		t.Errorf("children() = %+v", els)
+	}
+	if findElement(els, idName) != nil {
+		t.Errorf("findElement() found missing element")
+	}
+}
+
+func TestReadNumbers(t *testing.T) {
+	if v := readInt([]byte{0xFF, 0xFE}); v != -2 {
+		t.Errorf("readInt() = %v, want -2", v)
+	}
+	if v := readInt(nil); v != 0 {
+		t.Errorf("readInt() = %v, want 0", v)
+	}
+	if v := readFloat([]byte{0x3F, 0xC0, 0x00, 0x00}); v != 1.5 {
+		t.Errorf("readFloat() = %v, want 1.5", v)
+	}
+	if v := readFloat(ebmlFloat(48000)); v != 48000 {
+		t.Errorf("readFloat() = %v, want 48000", v)
+	}
+	if v := readString([]byte("eng\x00\x00")); v != "eng" {
+		t.Errorf("readString() = %q, want eng", v)
+	}
+}
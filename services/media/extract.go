@@ -0,0 +1,550 @@
+package media
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"time"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+	"github.com/webtor-io/video-info/services/subconv"
+)
+
+var (
+	ErrTrackNotFound    = errors.New("track not found")
+	ErrUnsupportedCodec = errors.New("unsupported codec")
+)
+
+// textCodecs maps codecs of text subtitle tracks to subconv formats
+var textCodecs = map[string]string{
+	"subrip":   subconv.FormatSRT,
+	"ass":      subconv.FormatASS,
+	"ssa":      subconv.FormatASS,
+	"webvtt":   subconv.FormatWebVTT,
+	"mov_text": "",
+}
+
+// IsTextCodec tells if subtitles of this codec can be extracted.
+func IsTextCodec(codec string) bool {
+	_, ok := textCodecs[codec]
+	return ok
+}
+
+// ExtractSubtitle reads all cues of text subtitle track with specific id.
+func ExtractSubtitle(r io.ReaderAt, size int64, id int) (*subconv.Track, error) {
+	c, err := detect(r)
+	if err != nil {
+		return nil, err
+	}
+	switch c {
+	case ContainerMatroska:
+		m, err := openMatroska(r, size)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse matroska")
+		}
+		return m.extractSubtitle(id)
+	case ContainerMP4:
+		m, err := openMP4(r, size)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse mp4")
+		}
+		return m.extractSubtitle(id)
+	}
+	return nil, ErrUnsupportedContainer
+}
+
+type mkvBlock struct {
+	start    time.Duration
+	duration time.Duration
+	data     []byte
+}
+
+func (m *matroska) track(number uint64) *mkvTrack {
+	for i := range m.tracks {
+		if m.tracks[i].number == number {
+			return &m.tracks[i]
+		}
+	}
+	return nil
+}
+
+func (m *matroska) extractSubtitle(id int) (*subconv.Track, error) {
+	t := m.track(uint64(id))
+	if t == nil || t.typ != mkvTrackSubtitle {
+		return nil, ErrTrackNotFound
+	}
+	format, ok := textCodecs[mkvCodec(t.codecID)]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnsupportedCodec, "codec=%v", t.codecID)
+	}
+	blocks, err := m.cueBlocks(t.number)
+	if err != nil || blocks == nil {
+		blocks, err = m.scanBlocks(t.number)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan clusters")
+		}
+	}
+	res := &subconv.Track{Language: t.language}
+	for i, b := range blocks {
+		d, err := t.decode(b.data)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode block")
+		}
+		end := b.start + b.duration
+		if b.duration == 0 && i+1 < len(blocks) {
+			end = blocks[i+1].start
+		}
+		res.Add(b.start, end, subconv.CueText(format, string(d)))
+	}
+	return res, nil
+}
+
+func (t *mkvTrack) decode(d []byte) ([]byte, error) {
+	switch t.compression {
+	case compressionZlib:
+		zr, err := zlib.NewReader(bytes.NewReader(d))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case compressionStripped:
+		return append(append([]byte{}, t.compSettings...), d...), nil
+	}
+	return d, nil
+}
+
+func (m *matroska) timecode(tc int64) time.Duration {
+	return time.Duration(tc * int64(m.timecodeScale))
+}
+
+// cueBlocks reads blocks referenced by cues. Returns nil if cues do not
+// point to exact block positions of the track.
+func (m *matroska) cueBlocks(number uint64) ([]mkvBlock, error) {
+	d, err := m.element(idCues)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	type pos struct {
+		cluster  int64
+		relative int64
+	}
+	var ps []pos
+	seen := map[pos]bool{}
+	for _, cp := range children(d) {
+		if cp.id != idCuePoint {
+			continue
+		}
+		for _, ctp := range children(cp.data) {
+			if ctp.id != idCueTrackPositions {
+				continue
+			}
+			p := pos{cluster: -1, relative: -1}
+			var track uint64
+			for _, e := range children(ctp.data) {
+				switch e.id {
+				case idCueTrack:
+					track = readUint(e.data)
+				case idCueClusterPosition:
+					p.cluster = int64(readUint(e.data))
+				case idCueRelativePosition:
+					p.relative = int64(readUint(e.data))
+				}
+			}
+			if track != number {
+				continue
+			}
+			if p.cluster < 0 || p.relative < 0 {
+				return nil, nil
+			}
+			if !seen[p] {
+				seen[p] = true
+				ps = append(ps, p)
+			}
+		}
+	}
+	if len(ps) == 0 {
+		return nil, nil
+	}
+	timecodes := map[int64]int64{}
+	var res []mkvBlock
+	for _, p := range ps {
+		off := m.segmentOffset + p.cluster
+		id, _, hl, err := readHeaderAt(m.r, off)
+		if err != nil {
+			return nil, err
+		}
+		if id != idCluster {
+			return nil, errors.Errorf("no cluster found at %v", off)
+		}
+		data := off + int64(hl)
+		tc, ok := timecodes[off]
+		if !ok {
+			tc, err = m.clusterTimecode(data)
+			if err != nil {
+				return nil, err
+			}
+			timecodes[off] = tc
+		}
+		b, err := m.readBlock(data+p.relative, number, tc)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			res = append(res, *b)
+		}
+	}
+	return res, nil
+}
+
+// clusterTimecode reads Timecode element which is expected to be the first
+// element of the cluster.
+func (m *matroska) clusterTimecode(off int64) (int64, error) {
+	for i := 0; i < 4; i++ {
+		id, s, hl, err := readHeaderAt(m.r, off)
+		if err != nil {
+			return 0, err
+		}
+		if s == unknownSize {
+			break
+		}
+		if id == idTimecode {
+			d, err := readAt(m.r, off+int64(hl), s)
+			if err != nil {
+				return 0, err
+			}
+			return int64(readUint(d)), nil
+		}
+		off += int64(hl) + s
+	}
+	return 0, errors.New("no cluster timecode found")
+}
+
+// readBlock reads SimpleBlock or BlockGroup at off, returns nil if it
+// belongs to another track.
+func (m *matroska) readBlock(off int64, number uint64, clusterTC int64) (*mkvBlock, error) {
+	id, s, hl, err := readHeaderAt(m.r, off)
+	if err != nil {
+		return nil, err
+	}
+	if s == unknownSize || (id != idSimpleBlock && id != idBlockGroup) {
+		return nil, errors.Errorf("no block found at %v", off)
+	}
+	// check track number before reading the whole element
+	head := make([]byte, 16)
+	n, _ := m.r.ReadAt(head, off+int64(hl))
+	head = head[:n]
+	if id == idBlockGroup {
+		bid, _, bhl, err := readHeader(head)
+		if err != nil {
+			return nil, err
+		}
+		if bid == idBlock {
+			head = head[bhl:]
+		}
+	}
+	track, _, err := readVint(head, false)
+	if err != nil {
+		return nil, err
+	}
+	if track != number {
+		return nil, nil
+	}
+	d, err := readAt(m.r, off+int64(hl), s)
+	if err != nil {
+		return nil, err
+	}
+	if id == idSimpleBlock {
+		return m.parseBlock(d, clusterTC, 0)
+	}
+	var block []byte
+	var duration int64
+	for _, e := range children(d) {
+		switch e.id {
+		case idBlock:
+			block = e.data
+		case idBlockDuration:
+			duration = int64(readUint(e.data))
+		}
+	}
+	if block == nil {
+		return nil, errors.Errorf("no block found in block group at %v", off)
+	}
+	return m.parseBlock(block, clusterTC, duration)
+}
+
+func (m *matroska) parseBlock(d []byte, clusterTC int64, duration int64) (*mkvBlock, error) {
+	_, l, err := readVint(d, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(d) < l+3 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	tc := int64(int16(binary.BigEndian.Uint16(d[l:])))
+	flags := d[l+2]
+	if flags&0x06 != 0 {
+		return nil, errors.New("laced subtitle blocks are not supported")
+	}
+	return &mkvBlock{
+		start:    m.timecode(clusterTC + tc),
+		duration: m.timecode(duration),
+		data:     d[l+3:],
+	}, nil
+}
+
+var topLevelIDs = map[uint32]bool{
+	idCluster: true, idCues: true, idChapters: true, idSeekHead: true,
+	idInfo: true, idTracks: true, 0x1254C367: true, 0x1941A469: true,
+}
+
+// scanBlocks walks through all clusters reading only element headers of
+// other tracks, it is used when cues are missing.
+func (m *matroska) scanBlocks(number uint64) ([]mkvBlock, error) {
+	off, ok := m.positions[idCluster]
+	if !ok {
+		return nil, errors.New("no clusters found")
+	}
+	var res []mkvBlock
+	var tc int64
+	end := m.segmentEnd
+	for off < m.segmentEnd {
+		id, s, hl, err := readHeaderAt(m.r, off)
+		if err != nil {
+			if off >= end {
+				break
+			}
+			return nil, err
+		}
+		switch {
+		case id == idCluster:
+			if s != unknownSize {
+				end = off + int64(hl) + s
+			} else {
+				end = m.segmentEnd
+			}
+			off += int64(hl)
+			continue
+		case topLevelIDs[id]:
+			if s == unknownSize {
+				return res, nil
+			}
+		case id == idTimecode:
+			d, err := readAt(m.r, off+int64(hl), s)
+			if err != nil {
+				return nil, err
+			}
+			tc = int64(readUint(d))
+		case id == idSimpleBlock || id == idBlockGroup:
+			b, err := m.readBlock(off, number, tc)
+			if err != nil {
+				return nil, err
+			}
+			if b != nil {
+				res = append(res, *b)
+			}
+		}
+		if s == unknownSize {
+			return nil, errors.Errorf("element id=%x has unknown size", id)
+		}
+		off += int64(hl) + s
+	}
+	return res, nil
+}
+
+// maxSamples limits number of samples of single subtitle track
+const maxSamples = 1 << 20
+
+type mp4Sample struct {
+	offset   int64
+	size     int64
+	start    uint64
+	duration uint64
+}
+
+func (m *mp4) track(id uint32) *mp4Track {
+	for _, t := range m.tracks {
+		if t.id == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// samples builds sample list from the sample table.
+func (t *mp4Track) sampleTable() ([]mp4Sample, error) {
+	stbl := boxes(t.stbl)
+	stsz := findBox(stbl, "stsz")
+	stsc := findBox(stbl, "stsc")
+	stts := findBox(stbl, "stts")
+	var offsets []int64
+	if d := findBox(stbl, "stco"); len(d) >= 8 {
+		n := int(binary.BigEndian.Uint32(d[4:]))
+		for i := 0; i < n && 8+i*4+4 <= len(d); i++ {
+			offsets = append(offsets, int64(binary.BigEndian.Uint32(d[8+i*4:])))
+		}
+	} else if d := findBox(stbl, "co64"); len(d) >= 8 {
+		n := int(binary.BigEndian.Uint32(d[4:]))
+		for i := 0; i < n && 8+i*8+8 <= len(d); i++ {
+			offsets = append(offsets, int64(binary.BigEndian.Uint64(d[8+i*8:])))
+		}
+	}
+	if len(stsz) < 12 || len(stsc) < 8 || len(stts) < 8 || offsets == nil {
+		return nil, errors.New("incomplete sample table")
+	}
+	count := int64(binary.BigEndian.Uint32(stsz[8:]))
+	fixed := int64(binary.BigEndian.Uint32(stsz[4:]))
+	// sample count is not trusted further than tables are able to describe
+	limit := int64(len(stsz)-12) / 4
+	if fixed != 0 {
+		limit = 0
+		for i := 0; i < int(binary.BigEndian.Uint32(stts[4:])) && 8+i*8+8 <= len(stts); i++ {
+			limit += int64(binary.BigEndian.Uint32(stts[8+i*8:]))
+		}
+	}
+	if count > limit {
+		count = limit
+	}
+	if count > maxSamples {
+		return nil, errors.Errorf("too many samples count=%v", count)
+	}
+	res := make([]mp4Sample, count)
+	for i := range res {
+		res[i].size = fixed
+		if fixed == 0 {
+			res[i].size = int64(binary.BigEndian.Uint32(stsz[12+i*4:]))
+		}
+	}
+	var start uint64
+	si := 0
+	for i := 0; i < int(binary.BigEndian.Uint32(stts[4:])) && 8+i*8+8 <= len(stts); i++ {
+		n := int(binary.BigEndian.Uint32(stts[8+i*8:]))
+		delta := uint64(binary.BigEndian.Uint32(stts[12+i*8:]))
+		for j := 0; j < n && si < len(res); j++ {
+			res[si].start = start
+			res[si].duration = delta
+			start += delta
+			si++
+		}
+	}
+	entries := int(binary.BigEndian.Uint32(stsc[4:]))
+	si = 0
+	for e := 0; e < entries && 8+e*12+12 <= len(stsc); e++ {
+		first := int(binary.BigEndian.Uint32(stsc[8+e*12:])) - 1
+		perChunk := int(binary.BigEndian.Uint32(stsc[12+e*12:]))
+		last := len(offsets)
+		if e+1 < entries && 8+(e+1)*12+4 <= len(stsc) {
+			last = int(binary.BigEndian.Uint32(stsc[8+(e+1)*12:])) - 1
+		}
+		for c := first; c < last && c < len(offsets); c++ {
+			off := offsets[c]
+			for j := 0; j < perChunk && si < len(res); j++ {
+				res[si].offset = off
+				off += res[si].size
+				si++
+			}
+		}
+	}
+	return res[:si], nil
+}
+
+func (m *mp4) extractSubtitle(id int) (*subconv.Track, error) {
+	t := m.track(uint32(id))
+	if t == nil || (t.handler != "sbtl" && t.handler != "subt" && t.handler != "text") {
+		return nil, ErrTrackNotFound
+	}
+	if t.codec != "tx3g" && t.codec != "text" && t.codec != "wvtt" {
+		return nil, errors.Wrapf(ErrUnsupportedCodec, "codec=%v", t.codec)
+	}
+	if t.timescale == 0 {
+		return nil, errors.New("no track timescale")
+	}
+	samples, err := t.sampleTable()
+	if err != nil {
+		return nil, err
+	}
+	res := &subconv.Track{Language: t.language}
+	ts := func(v uint64) time.Duration {
+		return time.Duration(float64(v) / float64(t.timescale) * float64(time.Second))
+	}
+	err = m.readSamples(samples, func(s *mp4Sample, d []byte) {
+		var text string
+		if t.codec == "wvtt" {
+			text = wvttText(d)
+		} else {
+			text = tx3gText(d)
+		}
+		res.Add(ts(s.start), ts(s.start+s.duration), text)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// readSamples reads samples merging adjacent ones into single reads.
+func (m *mp4) readSamples(samples []mp4Sample, fn func(s *mp4Sample, d []byte)) error {
+	for i := 0; i < len(samples); {
+		j := i + 1
+		end := samples[i].offset + samples[i].size
+		for j < len(samples) && samples[j].offset == end && end-samples[i].offset < 1024*1024 {
+			end += samples[j].size
+			j++
+		}
+		d, err := readAt(m.r, samples[i].offset, end-samples[i].offset)
+		if err != nil {
+			return errors.Wrap(err, "failed to read samples")
+		}
+		for k := i; k < j; k++ {
+			o := samples[k].offset - samples[i].offset
+			fn(&samples[k], d[o:o+samples[k].size])
+		}
+		i = j
+	}
+	return nil
+}
+
+func tx3gText(d []byte) string {
+	if len(d) < 2 {
+		return ""
+	}
+	l := int(binary.BigEndian.Uint16(d))
+	if l > len(d)-2 {
+		l = len(d) - 2
+	}
+	t := d[2 : 2+l]
+	if len(t) >= 2 && t[0] == 0xFE && t[1] == 0xFF {
+		u := make([]uint16, (len(t)-2)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(t[2+i*2:])
+		}
+		return string(utf16.Decode(u))
+	}
+	return string(t)
+}
+
+func wvttText(d []byte) string {
+	var res []string
+	for _, b := range boxes(d) {
+		if b.typ != "vttc" {
+			continue
+		}
+		if p := findBox(boxes(b.data), "payl"); p != nil {
+			res = append(res, subconv.CueText(subconv.FormatWebVTT, string(p)))
+		}
+	}
+	return joinLines(res)
+}
+
+func joinLines(s []string) string {
+	var b bytes.Buffer
+	for i, l := range s {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(l)
+	}
+	return b.String()
+}
@@ -0,0 +1,410 @@
+package media
+
+import (
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	idEBML                = 0x1A45DFA3
+	idDocType             = 0x4282
+	idSegment             = 0x18538067
+	idSeekHead            = 0x114D9B74
+	idSeek                = 0x4DBB
+	idSeekID              = 0x53AB
+	idSeekPosition        = 0x53AC
+	idInfo                = 0x1549A966
+	idTimecodeScale       = 0x2AD7B1
+	idDuration            = 0x4489
+	idTracks              = 0x1654AE6B
+	idTrackEntry          = 0xAE
+	idTrackNumber         = 0xD7
+	idTrackType           = 0x83
+	idFlagDefault         = 0x88
+	idFlagForced          = 0x55AA
+	idDefaultDuration     = 0x23E383
+	idName                = 0x536E
+	idLanguage            = 0x22B59C
+	idLanguageBCP47       = 0x22B59D
+	idCodecID             = 0x86
+	idCodecPrivate        = 0x63A2
+	idVideo               = 0xE0
+	idPixelWidth          = 0xB0
+	idPixelHeight         = 0xBA
+	idAudio               = 0xE1
+	idSamplingFrequency   = 0xB5
+	idChannels            = 0x9F
+	idCluster             = 0x1F43B675
+	idCues                = 0x1C53BB6B
+	idChapters            = 0x1043A770
+	idContentEncodings    = 0x6D80
+	idContentEncoding     = 0x6240
+	idContentCompression  = 0x5034
+	idContentCompAlgo     = 0x4254
+	idContentCompSettings = 0x4255
+	idTimecode            = 0xE7
+	idSimpleBlock         = 0xA3
+	idBlockGroup          = 0xA0
+	idBlock               = 0xA1
+	idBlockDuration       = 0x9B
+	idCuePoint            = 0xBB
+	idCueTime             = 0xB3
+	idCueTrackPositions   = 0xB7
+	idCueTrack            = 0xF7
+	idCueClusterPosition  = 0xF1
+	idCueRelativePosition = 0xF0
+)
+
+const (
+	mkvTrackVideo    = 1
+	mkvTrackAudio    = 2
+	mkvTrackSubtitle = 17
+)
+
+type mkvTrack struct {
+	number          uint64
+	typ             uint64
+	codecID         string
+	codecPrivate    []byte
+	language        string
+	name            string
+	def             bool
+	forced          bool
+	defaultDuration uint64
+	width           int
+	height          int
+	channels        int
+	sampleRate      float64
+	compression     int
+	compSettings    []byte
+}
+
+const (
+	compressionNone     = -1
+	compressionZlib     = 0
+	compressionStripped = 3
+)
+
+type matroska struct {
+	r             io.ReaderAt
+	size          int64
+	docType       string
+	segmentOffset int64
+	segmentEnd    int64
+	timecodeScale uint64
+	duration      float64
+	tracks        []mkvTrack
+	positions     map[uint32]int64
+}
+
+func openMatroska(r io.ReaderAt, size int64) (*matroska, error) {
+	m := &matroska{
+		r:             r,
+		size:          size,
+		timecodeScale: 1000000,
+		positions:     map[uint32]int64{},
+	}
+	id, s, hl, err := readHeaderAt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if id != idEBML || s == unknownSize {
+		return nil, errors.New("no ebml header found")
+	}
+	h, err := readAt(r, int64(hl), s)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read ebml header")
+	}
+	m.docType = ContainerMatroska
+	for _, e := range children(h) {
+		if e.id == idDocType {
+			m.docType = readString(e.data)
+		}
+	}
+	off := int64(hl) + s
+	id, s, hl, err = readHeaderAt(r, off)
+	if err != nil {
+		return nil, err
+	}
+	if id != idSegment {
+		return nil, errors.New("no segment found")
+	}
+	m.segmentOffset = off + int64(hl)
+	m.segmentEnd = size
+	if s != unknownSize && m.segmentOffset+s < size {
+		m.segmentEnd = m.segmentOffset + s
+	}
+	err = m.scan()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.readInfo(); err != nil {
+		return nil, errors.Wrap(err, "failed to read segment info")
+	}
+	if err := m.readTracks(); err != nil {
+		return nil, errors.Wrap(err, "failed to read tracks")
+	}
+	return m, nil
+}
+
+// scan walks top-level elements up to the first cluster and follows seek
+// heads to locate elements stored after media data.
+func (m *matroska) scan() error {
+	off := m.segmentOffset
+	for i := 0; i < 128 && off < m.segmentEnd; i++ {
+		id, s, hl, err := readHeaderAt(m.r, off)
+		if err != nil {
+			return err
+		}
+		if _, ok := m.positions[id]; !ok {
+			m.positions[id] = off
+		}
+		if id == idCluster || s == unknownSize {
+			break
+		}
+		if id == idSeekHead {
+			if err := m.readSeekHead(off, 0); err != nil {
+				return err
+			}
+		}
+		off += int64(hl) + s
+	}
+	return nil
+}
+
+func (m *matroska) readSeekHead(off int64, depth int) error {
+	d, err := m.readElement(off, idSeekHead)
+	if err != nil {
+		return errors.Wrap(err, "failed to read seek head")
+	}
+	for _, e := range children(d) {
+		if e.id != idSeek {
+			continue
+		}
+		var sid uint32
+		var pos int64 = -1
+		for _, se := range children(e.data) {
+			switch se.id {
+			case idSeekID:
+				sid = uint32(readUint(se.data))
+			case idSeekPosition:
+				pos = int64(readUint(se.data))
+			}
+		}
+		if sid == 0 || pos < 0 {
+			continue
+		}
+		abs := m.segmentOffset + pos
+		if sid == idSeekHead && abs != off && depth == 0 {
+			if err := m.readSeekHead(abs, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := m.positions[sid]; !ok {
+			m.positions[sid] = abs
+		}
+	}
+	return nil
+}
+
+// readElement reads body of element with specific id at off.
+func (m *matroska) readElement(off int64, id uint32) ([]byte, error) {
+	eid, s, hl, err := readHeaderAt(m.r, off)
+	if err != nil {
+		return nil, err
+	}
+	if eid != id {
+		return nil, errors.Errorf("unexpected element id=%x at %v", eid, off)
+	}
+	if s == unknownSize {
+		return nil, errors.Errorf("element id=%x has unknown size", id)
+	}
+	return readAt(m.r, off+int64(hl), s)
+}
+
+// element reads top-level element by id, returns nil if there is no such element.
+func (m *matroska) element(id uint32) ([]byte, error) {
+	off, ok := m.positions[id]
+	if !ok {
+		return nil, nil
+	}
+	return m.readElement(off, id)
+}
+
+func (m *matroska) readInfo() error {
+	d, err := m.element(idInfo)
+	if err != nil || d == nil {
+		return err
+	}
+	var duration float64
+	for _, e := range children(d) {
+		switch e.id {
+		case idTimecodeScale:
+			m.timecodeScale = readUint(e.data)
+		case idDuration:
+			duration = readFloat(e.data)
+		}
+	}
+	m.duration = duration * float64(m.timecodeScale) / 1e9
+	return nil
+}
+
+func (m *matroska) readTracks() error {
+	d, err := m.element(idTracks)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return errors.New("no tracks found")
+	}
+	for _, e := range children(d) {
+		if e.id != idTrackEntry {
+			continue
+		}
+		t := mkvTrack{language: "eng", def: true, compression: compressionNone}
+		var bcp47 string
+		for _, te := range children(e.data) {
+			switch te.id {
+			case idTrackNumber:
+				t.number = readUint(te.data)
+			case idTrackType:
+				t.typ = readUint(te.data)
+			case idCodecID:
+				t.codecID = readString(te.data)
+			case idCodecPrivate:
+				t.codecPrivate = te.data
+			case idLanguage:
+				t.language = readString(te.data)
+			case idLanguageBCP47:
+				bcp47 = readString(te.data)
+			case idName:
+				t.name = readString(te.data)
+			case idFlagDefault:
+				t.def = readUint(te.data) == 1
+			case idFlagForced:
+				t.forced = readUint(te.data) == 1
+			case idDefaultDuration:
+				t.defaultDuration = readUint(te.data)
+			case idContentEncodings:
+				for _, ce := range children(te.data) {
+					if ce.id != idContentEncoding {
+						continue
+					}
+					for _, cc := range children(findElement(children(ce.data), idContentCompression)) {
+						switch cc.id {
+						case idContentCompAlgo:
+							t.compression = int(readUint(cc.data))
+						case idContentCompSettings:
+							t.compSettings = cc.data
+						}
+					}
+					if t.compression == compressionNone && findElement(children(ce.data), idContentCompression) != nil {
+						t.compression = compressionZlib
+					}
+				}
+			case idVideo:
+				for _, ve := range children(te.data) {
+					switch ve.id {
+					case idPixelWidth:
+						t.width = int(readUint(ve.data))
+					case idPixelHeight:
+						t.height = int(readUint(ve.data))
+					}
+				}
+			case idAudio:
+				t.sampleRate = 8000
+				t.channels = 1
+				for _, ae := range children(te.data) {
+					switch ae.id {
+					case idSamplingFrequency:
+						t.sampleRate = readFloat(ae.data)
+					case idChannels:
+						t.channels = int(readUint(ae.data))
+					}
+				}
+			}
+		}
+		if bcp47 != "" {
+			t.language = bcp47
+		}
+		m.tracks = append(m.tracks, t)
+	}
+	return nil
+}
+
+var mkvCodecs = map[string]string{
+	"V_MPEG4/ISO/AVC":    "h264",
+	"V_MPEGH/ISO/HEVC":   "hevc",
+	"V_AV1":              "av1",
+	"V_VP8":              "vp8",
+	"V_VP9":              "vp9",
+	"V_MPEG4/ISO/ASP":    "mpeg4",
+	"V_MPEG2":            "mpeg2video",
+	"V_MS/VFW/FOURCC":    "vfw",
+	"A_AAC":              "aac",
+	"A_AC3":              "ac3",
+	"A_EAC3":             "eac3",
+	"A_DTS":              "dts",
+	"A_TRUEHD":           "truehd",
+	"A_OPUS":             "opus",
+	"A_VORBIS":           "vorbis",
+	"A_FLAC":             "flac",
+	"A_MPEG/L3":          "mp3",
+	"A_MPEG/L2":          "mp2",
+	"S_TEXT/UTF8":        "subrip",
+	"S_TEXT/ASCII":       "subrip",
+	"S_TEXT/SSA":         "ssa",
+	"S_TEXT/ASS":         "ass",
+	"S_TEXT/WEBVTT":      "webvtt",
+	"D_WEBVTT/SUBTITLES": "webvtt",
+	"S_HDMV/PGS":         "pgs",
+	"S_VOBSUB":           "vobsub",
+	"S_DVBSUB":           "dvbsub",
+}
+
+func mkvCodec(id string) string {
+	if c, ok := mkvCodecs[id]; ok {
+		return c
+	}
+	if strings.HasPrefix(id, "A_AAC") {
+		return "aac"
+	}
+	return strings.ToLower(id)
+}
+
+func (m *matroska) info() *Info {
+	i := &Info{
+		Container: m.docType,
+		Duration:  m.duration,
+		Video:     []VideoTrack{},
+		Audio:     []AudioTrack{},
+		Subtitles: []SubtitleTrack{},
+		Chapters:  []Chapter{},
+	}
+	for _, t := range m.tracks {
+		tr := Track{
+			ID:       int(t.number),
+			Codec:    mkvCodec(t.codecID),
+			Language: t.language,
+			Name:     t.name,
+			Default:  t.def,
+			Forced:   t.forced,
+		}
+		switch t.typ {
+		case mkvTrackVideo:
+			v := VideoTrack{Track: tr, Width: t.width, Height: t.height}
+			if t.defaultDuration > 0 {
+				v.FPS = 1e9 / float64(t.defaultDuration)
+			}
+			i.Video = append(i.Video, v)
+		case mkvTrackAudio:
+			i.Audio = append(i.Audio, AudioTrack{Track: tr, Channels: t.channels, SampleRate: t.sampleRate})
+		case mkvTrackSubtitle:
+			i.Subtitles = append(i.Subtitles, SubtitleTrack{Track: tr})
+		}
+	}
+	return i
+}
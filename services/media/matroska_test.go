@@ -0,0 +1,199 @@
+package media
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/webtor-io/video-info/services/subconv"
+)
+
+func mkvHeader() []byte {
+	return ebml(idEBML, ebml(idDocType, []byte("matroska")))
+}
+
+func mkvInfo() []byte {
+	return ebml(idInfo, ebml(idTimecodeScale, ebmlUint(1000000)), ebml(idDuration, ebmlFloat(60000)))
+}
+
+func mkvTracks() []byte {
+	return ebml(idTracks,
+		ebml(idTrackEntry,
+			ebml(idTrackNumber, ebmlUint(1)),
+			ebml(idTrackType, ebmlUint(mkvTrackVideo)),
+			ebml(idCodecID, []byte("V_MPEG4/ISO/AVC")),
+			ebml(idDefaultDuration, ebmlUint(40000000)),
+			ebml(idVideo, ebml(idPixelWidth, ebmlUint(1920)), ebml(idPixelHeight, ebmlUint(1080))),
+		),
+		ebml(idTrackEntry,
+			ebml(idTrackNumber, ebmlUint(2)),
+			ebml(idTrackType, ebmlUint(mkvTrackAudio)),
+			ebml(idCodecID, []byte("A_AAC/MPEG4/LC")),
+			ebml(idLanguage, []byte("rus")),
+			ebml(idFlagDefault, ebmlUint(0)),
+			ebml(idAudio, ebml(idSamplingFrequency, ebmlFloat(48000)), ebml(idChannels, ebmlUint(6))),
+		),
+		ebml(idTrackEntry,
+			ebml(idTrackNumber, ebmlUint(3)),
+			ebml(idTrackType, ebmlUint(mkvTrackSubtitle)),
+			ebml(idCodecID, []byte("S_TEXT/ASS")),
+			ebml(idName, []byte("English")),
+			ebml(idFlagForced, ebmlUint(1)),
+		),
+	)
+}
+
+// mkvBlockData makes block of track with timecode relative to cluster.
+func mkvBlockData(track byte, tc int16, text string) []byte {
+	return append([]byte{0x80 | track, byte(uint16(tc) >> 8), byte(tc), 0}, text...)
+}
+
+func mkvClusters(unknown bool) []byte {
+	c1 := [][]byte{
+		ebml(idTimecode, ebmlUint(1000)),
+		ebml(idSimpleBlock, mkvBlockData(1, 0, "video")),
+		ebml(idBlockGroup,
+			ebml(idBlock, mkvBlockData(3, 500, "0,0,Default,,0,0,0,,{\\i1}Hello{\\i0}\\Nworld")),
+			ebml(idBlockDuration, ebmlUint(1500)),
+		),
+	}
+	c2 := [][]byte{
+		ebml(idTimecode, ebmlUint(5000)),
+		ebml(idSimpleBlock, mkvBlockData(3, 0, "1,0,Default,,0,0,0,,Second")),
+	}
+	if unknown {
+		return append(ebmlUnknown(idCluster, c1...), ebmlUnknown(idCluster, c2...)...)
+	}
+	return append(ebml(idCluster, c1...), ebml(idCluster, c2...)...)
+}
+
+func mkvChapters() []byte {
+	atom := func(start uint64, title string, hidden bool) []byte {
+		h := uint64(0)
+		if hidden {
+			h = 1
+		}
+		return ebml(idChapterAtom,
+			ebml(idChapterTimeStart, ebmlUint(start)),
+			ebml(idChapterFlagHidden, ebmlUint(h)),
+			ebml(idChapterDisplay, ebml(idChapString, []byte(title))),
+		)
+	}
+	return ebml(idChapters,
+		ebml(idEditionEntry, atom(0, "Other edition", false)),
+		ebml(idEditionEntry,
+			ebml(idEditionFlagDefault, ebmlUint(1)),
+			atom(30e9, "Second", false),
+			atom(0, "First", false),
+			atom(10e9, "Hidden", true),
+		),
+	)
+}
+
+var mkvWant = &Info{
+	Container: ContainerMatroska,
+	Duration:  60,
+	Video: []VideoTrack{
+		{Track: Track{ID: 1, Codec: "h264", Language: "eng", Default: true}, Width: 1920, Height: 1080, FPS: 25},
+	},
+	Audio: []AudioTrack{
+		{Track: Track{ID: 2, Codec: "aac", Language: "rus"}, Channels: 6, SampleRate: 48000},
+	},
+	Subtitles: []SubtitleTrack{
+		{Track: Track{ID: 3, Codec: "ass", Language: "eng", Name: "English", Default: true, Forced: true}},
+	},
+	Chapters: []Chapter{},
+}
+
+func TestProbeMatroska(t *testing.T) {
+	withChapters := *mkvWant
+	withChapters.Chapters = []Chapter{
+		{Start: 0, End: 30, Title: "First"},
+		{Start: 30, End: 60, Title: "Second"},
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want *Info
+	}{
+		{
+			name: "known sizes",
+			data: append(mkvHeader(), ebml(idSegment, mkvInfo(), mkvTracks(), mkvClusters(false))...),
+			want: mkvWant,
+		},
+		{
+			name: "unknown segment and cluster sizes",
+			data: append(mkvHeader(), ebmlUnknown(idSegment, mkvInfo(), mkvTracks(), mkvClusters(true))...),
+			want: mkvWant,
+		},
+		{
+			name: "chapters",
+			data: append(mkvHeader(), ebml(idSegment, mkvInfo(), mkvTracks(), mkvChapters(), mkvClusters(false))...),
+			want: &withChapters,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Probe(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Probe() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeMatroskaSeekHead(t *testing.T) {
+	// tracks are stored after clusters and located with seek head
+	seekHead := func(pos uint64) []byte {
+		return ebml(idSeekHead, ebml(idSeek, ebml(idSeekID, ebmlID(idTracks)), ebml(idSeekPosition, ebmlUint(pos))))
+	}
+	l := len(seekHead(0))
+	pos := uint64(l + len(mkvInfo()) + len(mkvClusters(false)))
+	d := append(mkvHeader(), ebml(idSegment, seekHead(pos), mkvInfo(), mkvClusters(false), mkvTracks())...)
+	got, err := Probe(bytes.NewReader(d), int64(len(d)))
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, mkvWant) {
+		t.Errorf("Probe() = %+v, want %+v", got, mkvWant)
+	}
+}
+
+func TestExtractSubtitleMatroska(t *testing.T) {
+	want := []subconv.Cue{
+		{Start: 1500 * time.Millisecond, End: 3000 * time.Millisecond, Text: "<i>Hello</i>\nworld"},
+		{Start: 5000 * time.Millisecond, End: 7000 * time.Millisecond, Text: "Second"},
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "known sizes",
+			data: append(mkvHeader(), ebml(idSegment, mkvInfo(), mkvTracks(), mkvClusters(false))...),
+		},
+		{
+			name: "unknown sizes",
+			data: append(mkvHeader(), ebmlUnknown(idSegment, mkvInfo(), mkvTracks(), mkvClusters(true))...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractSubtitle(bytes.NewReader(tt.data), int64(len(tt.data)), 3)
+			if err != nil {
+				t.Fatalf("ExtractSubtitle() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Cues, want) {
+				t.Errorf("ExtractSubtitle() = %+v, want %+v", got.Cues, want)
+			}
+		})
+	}
+	d := tests[0].data
+	if _, err := ExtractSubtitle(bytes.NewReader(d), int64(len(d)), 2); err != ErrTrackNotFound {
+		t.Errorf("ExtractSubtitle() of audio track error = %v, want %v", err, ErrTrackNotFound)
+	}
+}
@@ -0,0 +1,130 @@
+package media
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ContainerMatroska = "matroska"
+	ContainerWebM     = "webm"
+	ContainerMP4      = "mp4"
+	ContainerMOV      = "mov"
+)
+
+var (
+	ErrUnsupportedContainer = errors.New("unsupported container")
+)
+
+// maxElementSize limits size of metadata elements read into memory
+const maxElementSize = 64 * 1024 * 1024
+
+type Track struct {
+	ID       int    `json:"id"`
+	Codec    string `json:"codec"`
+	Language string `json:"language,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Default  bool   `json:"default"`
+	Forced   bool   `json:"forced"`
+}
+
+type VideoTrack struct {
+	Track
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	FPS    float64 `json:"fps,omitempty"`
+}
+
+type AudioTrack struct {
+	Track
+	Channels   int     `json:"channels,omitempty"`
+	SampleRate float64 `json:"sample_rate,omitempty"`
+}
+
+type SubtitleTrack struct {
+	Track
+}
+
+type Info struct {
+	Container string          `json:"container"`
+	Duration  float64         `json:"duration"`
+	Video     []VideoTrack    `json:"video"`
+	Audio     []AudioTrack    `json:"audio"`
+	Subtitles []SubtitleTrack `json:"subtitles"`
+	Chapters  []Chapter       `json:"chapters"`
+}
+
+// Probe reads container metadata using as few reads as possible, media
+// data itself is never read except for titles of MP4 chapter track.
+// Broken chapters are ignored so they don't hide the rest of metadata.
+func Probe(r io.ReaderAt, size int64) (*Info, error) {
+	c, err := detect(r)
+	if err != nil {
+		return nil, err
+	}
+	switch c {
+	case ContainerMatroska:
+		m, err := openMatroska(r, size)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse matroska")
+		}
+		i := m.info()
+		if cs, err := m.chapters(); err == nil && cs != nil {
+			i.Chapters = cs
+		}
+		return i, nil
+	case ContainerMP4:
+		m, err := openMP4(r, size)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse mp4")
+		}
+		i := m.info()
+		if cs, err := m.chapters(); err == nil && cs != nil {
+			i.Chapters = cs
+		}
+		return i, nil
+	}
+	return nil, ErrUnsupportedContainer
+}
+
+func detect(r io.ReaderAt) (string, error) {
+	buf := make([]byte, 12)
+	n, err := r.ReadAt(buf, 0)
+	if n < len(buf) {
+		return "", errors.Wrap(err, "failed to read header")
+	}
+	if bytes.HasPrefix(buf, []byte{0x1A, 0x45, 0xDF, 0xA3}) {
+		return ContainerMatroska, nil
+	}
+	switch string(buf[4:8]) {
+	case "ftyp", "moov", "mdat", "free", "wide", "skip":
+		return ContainerMP4, nil
+	}
+	return "", ErrUnsupportedContainer
+}
+
+// readFull reads exactly len(buf) bytes at off.
+func readFull(r io.ReaderAt, buf []byte, off int64) error {
+	n, err := r.ReadAt(buf, off)
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return errors.Wrapf(err, "failed to read %v bytes at %v", len(buf), off)
+}
+
+func readAt(r io.ReaderAt, off int64, size int64) ([]byte, error) {
+	if size < 0 || size > maxElementSize {
+		return nil, errors.Errorf("element is too large size=%v", size)
+	}
+	buf := make([]byte, size)
+	err := readFull(r, buf, off)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,82 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// ebml builds EBML element with 8 byte size
+func ebml(id uint32, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(body)))
+	size[0] = 0x01
+	return append(append(ebmlID(id), size...), body...)
+}
+
+// ebmlUnknown builds EBML element of unknown size
+func ebmlUnknown(id uint32, data ...[]byte) []byte {
+	return append(append(ebmlID(id), 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF), bytes.Join(data, nil)...)
+}
+
+func ebmlID(id uint32) []byte {
+	switch {
+	case id > 0xFFFFFF:
+		return []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+	case id > 0xFFFF:
+		return []byte{byte(id >> 16), byte(id >> 8), byte(id)}
+	case id > 0xFF:
+		return []byte{byte(id >> 8), byte(id)}
+	}
+	return []byte{byte(id)}
+}
+
+func ebmlUint(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+func ebmlFloat(v float64) []byte {
+	return ebmlUint(math.Float64bits(v))
+}
+
+// mp4Box builds MP4 box with 32 bit size
+func mp4Box(typ string, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	return append(binary.BigEndian.AppendUint32([]byte{}, uint32(len(body)+8)), append([]byte(typ), body...)...)
+}
+
+// mp4LargeBox builds MP4 box with 64 bit size
+func mp4LargeBox(typ string, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	h := binary.BigEndian.AppendUint32(nil, 1)
+	h = append(h, typ...)
+	h = binary.BigEndian.AppendUint64(h, uint64(len(body)+16))
+	return append(h, body...)
+}
+
+func be32(v ...uint32) []byte {
+	var b []byte
+	for _, x := range v {
+		b = binary.BigEndian.AppendUint32(b, x)
+	}
+	return b
+}
+
+func TestProbeUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "garbage", data: []byte("definitely not a video file")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Probe(bytes.NewReader(tt.data), int64(len(tt.data))); err == nil {
+				t.Errorf("Probe() error = nil, want error")
+			}
+		})
+	}
+}
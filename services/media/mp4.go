@@ -0,0 +1,313 @@
+package media
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type box struct {
+	typ  string
+	data []byte
+}
+
+type mp4Track struct {
+	id          uint32
+	enabled     bool
+	handler     string
+	codec       string
+	sampleEntry []byte
+	language    string
+	timescale   uint32
+	duration    uint64
+	width       int
+	height      int
+	channels    int
+	sampleRate  float64
+	samples     uint64
+	stbl        []byte
+	tref        map[string][]uint32
+}
+
+type mp4 struct {
+	r         io.ReaderAt
+	size      int64
+	brand     string
+	timescale uint32
+	duration  uint64
+	tracks    []*mp4Track
+	udta      []byte
+}
+
+// boxes splits box data into child boxes.
+func boxes(b []byte) []box {
+	var res []box
+	for len(b) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(b))
+		typ := string(b[4:8])
+		hl := uint64(8)
+		if size == 1 {
+			if len(b) < 16 {
+				break
+			}
+			size = binary.BigEndian.Uint64(b[8:])
+			hl = 16
+		} else if size == 0 {
+			size = uint64(len(b))
+		}
+		if size < hl || size > uint64(len(b)) {
+			break
+		}
+		res = append(res, box{typ: typ, data: b[hl:size]})
+		b = b[size:]
+	}
+	return res
+}
+
+func findBox(bs []box, typ string) []byte {
+	for _, b := range bs {
+		if b.typ == typ {
+			return b.data
+		}
+	}
+	return nil
+}
+
+func openMP4(r io.ReaderAt, size int64) (*mp4, error) {
+	m := &mp4{r: r, size: size}
+	var moov []byte
+	var off int64
+	buf := make([]byte, 16)
+	for i := 0; i < 64 && off+8 <= size; i++ {
+		err := readFull(r, buf[:8], off)
+		if err != nil {
+			return nil, err
+		}
+		bs := int64(binary.BigEndian.Uint32(buf))
+		typ := string(buf[4:8])
+		hl := int64(8)
+		if bs == 1 {
+			err := readFull(r, buf[8:16], off+8)
+			if err != nil {
+				return nil, err
+			}
+			bs = int64(binary.BigEndian.Uint64(buf[8:]))
+			hl = 16
+		} else if bs == 0 {
+			bs = size - off
+		}
+		if bs < hl {
+			return nil, errors.Errorf("invalid box size=%v at %v", bs, off)
+		}
+		switch typ {
+		case "ftyp":
+			d, err := readAt(r, off+hl, bs-hl)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read ftyp")
+			}
+			if len(d) >= 4 {
+				m.brand = string(d[:4])
+			}
+		case "moov":
+			moov, err = readAt(r, off+hl, bs-hl)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read moov")
+			}
+		}
+		if moov != nil {
+			break
+		}
+		off += bs
+	}
+	if moov == nil {
+		return nil, errors.New("no moov box found")
+	}
+	m.parseMoov(moov)
+	return m, nil
+}
+
+func (m *mp4) parseMoov(moov []byte) {
+	for _, b := range boxes(moov) {
+		switch b.typ {
+		case "mvhd":
+			d := b.data
+			if len(d) >= 32 && d[0] == 1 {
+				m.timescale = binary.BigEndian.Uint32(d[20:])
+				m.duration = binary.BigEndian.Uint64(d[24:])
+			} else if len(d) >= 20 {
+				m.timescale = binary.BigEndian.Uint32(d[12:])
+				m.duration = uint64(binary.BigEndian.Uint32(d[16:]))
+			}
+		case "trak":
+			m.tracks = append(m.tracks, parseTrak(b.data))
+		case "udta":
+			m.udta = b.data
+		}
+	}
+}
+
+func parseTrak(trak []byte) *mp4Track {
+	t := &mp4Track{language: "und", tref: map[string][]uint32{}}
+	tbs := boxes(trak)
+	if d := findBox(tbs, "tkhd"); len(d) >= 4 {
+		t.enabled = d[3]&1 == 1
+		if d[0] == 1 && len(d) >= 24 {
+			t.id = binary.BigEndian.Uint32(d[20:])
+		} else if len(d) >= 16 {
+			t.id = binary.BigEndian.Uint32(d[12:])
+		}
+		if len(d) >= 84 {
+			t.width = int(binary.BigEndian.Uint32(d[len(d)-8:]) >> 16)
+			t.height = int(binary.BigEndian.Uint32(d[len(d)-4:]) >> 16)
+		}
+	}
+	if d := findBox(tbs, "tref"); d != nil {
+		for _, rb := range boxes(d) {
+			for i := 0; i+4 <= len(rb.data); i += 4 {
+				t.tref[rb.typ] = append(t.tref[rb.typ], binary.BigEndian.Uint32(rb.data[i:]))
+			}
+		}
+	}
+	mdia := boxes(findBox(tbs, "mdia"))
+	if d := findBox(mdia, "mdhd"); len(d) >= 4 {
+		var lang uint16
+		if d[0] == 1 && len(d) >= 34 {
+			t.timescale = binary.BigEndian.Uint32(d[20:])
+			t.duration = binary.BigEndian.Uint64(d[24:])
+			lang = binary.BigEndian.Uint16(d[32:])
+		} else if len(d) >= 22 {
+			t.timescale = binary.BigEndian.Uint32(d[12:])
+			t.duration = uint64(binary.BigEndian.Uint32(d[16:]))
+			lang = binary.BigEndian.Uint16(d[20:])
+		}
+		t.language = unpackLanguage(lang)
+	}
+	if d := findBox(mdia, "elng"); len(d) > 4 {
+		t.language = readString(d[4:])
+	}
+	if d := findBox(mdia, "hdlr"); len(d) >= 12 {
+		t.handler = string(d[8:12])
+	}
+	t.stbl = findBox(boxes(findBox(mdia, "minf")), "stbl")
+	stbl := boxes(t.stbl)
+	if d := findBox(stbl, "stsd"); len(d) >= 8 {
+		if es := boxes(d[8:]); len(es) > 0 {
+			t.codec = es[0].typ
+			t.sampleEntry = es[0].data
+			e := es[0].data
+			switch t.handler {
+			case "vide":
+				if len(e) >= 28 {
+					t.width = int(binary.BigEndian.Uint16(e[24:]))
+					t.height = int(binary.BigEndian.Uint16(e[26:]))
+				}
+			case "soun":
+				if len(e) >= 28 {
+					t.channels = int(binary.BigEndian.Uint16(e[16:]))
+					t.sampleRate = float64(binary.BigEndian.Uint32(e[24:]) >> 16)
+				}
+			}
+		}
+	}
+	if d := findBox(stbl, "stts"); len(d) >= 8 {
+		n := binary.BigEndian.Uint32(d[4:])
+		for i := uint32(0); i < n && int(8+i*8+8) <= len(d); i++ {
+			t.samples += uint64(binary.BigEndian.Uint32(d[8+i*8:]))
+		}
+	}
+	return t
+}
+
+// unpackLanguage decodes ISO-639-2/T language packed into 15 bits.
+func unpackLanguage(l uint16) string {
+	if l == 0 || l == 0x7FFF {
+		return "und"
+	}
+	return string([]byte{
+		byte(l>>10&0x1F) + 0x60,
+		byte(l>>5&0x1F) + 0x60,
+		byte(l&0x1F) + 0x60,
+	})
+}
+
+var mp4Codecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"av01": "av1",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"Opus": "opus",
+	"fLaC": "flac",
+	".mp3": "mp3",
+	"tx3g": "mov_text",
+	"text": "mov_text",
+	"wvtt": "webvtt",
+	"stpp": "ttml",
+	"c608": "eia_608",
+}
+
+func mp4Codec(c string) string {
+	if v, ok := mp4Codecs[c]; ok {
+		return v
+	}
+	return strings.TrimSpace(c)
+}
+
+// chapterTracks returns ids of tracks referenced as chapter tracks.
+func (m *mp4) chapterTracks() map[uint32]bool {
+	res := map[uint32]bool{}
+	for _, t := range m.tracks {
+		for _, id := range t.tref["chap"] {
+			res[id] = true
+		}
+	}
+	return res
+}
+
+func (m *mp4) info() *Info {
+	i := &Info{
+		Container: ContainerMP4,
+		Video:     []VideoTrack{},
+		Audio:     []AudioTrack{},
+		Subtitles: []SubtitleTrack{},
+		Chapters:  []Chapter{},
+	}
+	if m.brand == "qt  " {
+		i.Container = ContainerMOV
+	}
+	if m.timescale > 0 {
+		i.Duration = float64(m.duration) / float64(m.timescale)
+	}
+	chapters := m.chapterTracks()
+	for _, t := range m.tracks {
+		tr := Track{
+			ID:       int(t.id),
+			Codec:    mp4Codec(t.codec),
+			Language: t.language,
+			Default:  t.enabled,
+		}
+		switch t.handler {
+		case "vide":
+			v := VideoTrack{Track: tr, Width: t.width, Height: t.height}
+			if t.duration > 0 && t.timescale > 0 {
+				v.FPS = float64(t.samples) * float64(t.timescale) / float64(t.duration)
+			}
+			i.Video = append(i.Video, v)
+		case "soun":
+			i.Audio = append(i.Audio, AudioTrack{Track: tr, Channels: t.channels, SampleRate: t.sampleRate})
+		case "sbtl", "subt", "text":
+			if chapters[t.id] {
+				continue
+			}
+			i.Subtitles = append(i.Subtitles, SubtitleTrack{Track: tr})
+		}
+	}
+	return i
+}
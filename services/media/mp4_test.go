@@ -0,0 +1,234 @@
+package media
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/webtor-io/video-info/services/subconv"
+)
+
+func TestBoxes(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []box
+	}{
+		{
+			name: "32 bit sizes",
+			data: append(mp4Box("free", []byte{1, 2}), mp4Box("skip")...),
+			want: []box{{typ: "free", data: []byte{1, 2}}, {typ: "skip", data: []byte{}}},
+		},
+		{
+			name: "64 bit size",
+			data: append(mp4LargeBox("mdat", []byte("data")), mp4Box("free", []byte{3})...),
+			want: []box{{typ: "mdat", data: []byte("data")}, {typ: "free", data: []byte{3}}},
+		},
+		{
+			name: "size till the end",
+			data: append(be32(0), append([]byte("mdat"), 1, 2, 3)...),
+			want: []box{{typ: "mdat", data: []byte{1, 2, 3}}},
+		},
+		{
+			name: "truncated",
+			data: append(mp4Box("free", []byte{1}), be32(100)...),
+			want: []box{{typ: "free", data: []byte{1}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := boxes(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("boxes() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+const mp4LangEng = 0x15C7 // "eng" packed into 15 bits
+
+func mp4Trak(id uint32, handler string, timescale uint32, duration uint32, entry []byte, stbl [][]byte, extra ...[]byte) []byte {
+	tkhd := mp4Box("tkhd", be32(1, 0, 0, id, 0, duration), make([]byte, 52), be32(1920<<16, 1080<<16))
+	mdhd := mp4Box("mdhd", be32(0, 0, 0, timescale, duration), []byte{mp4LangEng >> 8, mp4LangEng & 0xFF, 0, 0})
+	hdlr := mp4Box("hdlr", be32(0, 0), []byte(handler), make([]byte, 13))
+	stsd := mp4Box("stsd", be32(0, 1), entry)
+	parts := append([][]byte{tkhd}, extra...)
+	parts = append(parts, mp4Box("mdia", mdhd, hdlr, mp4Box("minf", mp4Box("stbl", append([][]byte{stsd}, stbl...)...))))
+	return mp4Box("trak", parts...)
+}
+
+func tx3gSample(text string) []byte {
+	return append([]byte{byte(len(text) >> 8), byte(len(text))}, text...)
+}
+
+// mkMP4 makes file with video, audio, tx3g subtitle and chapter tracks.
+// Media data is stored in 64 bit mdat box, subtitle samples are located
+// with co64 box.
+func mkMP4(brand string, udta []byte) []byte {
+	subs := [][]byte{tx3gSample("Hello"), tx3gSample(""), tx3gSample("World")}
+	chaps := [][]byte{tx3gSample("Intro"), tx3gSample("Main")}
+	ftyp := mp4Box("ftyp", []byte(brand), be32(0))
+	data := bytes.Join(append(append([][]byte{}, subs...), chaps...), nil)
+	mdat := mp4LargeBox("mdat", data)
+	subOff := uint64(len(ftyp) + 16)
+	chapOff := subOff + uint64(len(bytes.Join(subs, nil)))
+
+	video := make([]byte, 78)
+	copy(video[24:], []byte{1920 >> 8, 1920 & 0xFF, 1080 >> 8, 1080 & 0xFF})
+	audio := make([]byte, 28)
+	copy(audio[16:], []byte{0, 2})
+	copy(audio[24:], be32(44100<<16))
+
+	vtrak := mp4Trak(1, "vide", 25000, 250000, mp4Box("avc1", video), [][]byte{
+		mp4Box("stts", be32(0, 1, 250, 1000)),
+	}, mp4Box("tref", mp4Box("chap", be32(4))))
+	atrak := mp4Trak(2, "soun", 44100, 441000, mp4Box("mp4a", audio), nil)
+	strak := mp4Trak(3, "sbtl", 1000, 10000, mp4Box("tx3g", make([]byte, 30)), [][]byte{
+		mp4Box("stts", be32(0, 3, 1, 1000, 1, 2000, 1, 1500)),
+		mp4Box("stsz", be32(0, 0, 3, uint32(len(subs[0])), uint32(len(subs[1])), uint32(len(subs[2])))),
+		mp4Box("stsc", be32(0, 1, 1, 3, 1)),
+		mp4Box("co64", be32(0, 1), be32(uint32(subOff>>32), uint32(subOff))),
+	})
+	ctrak := mp4Trak(4, "text", 1000, 10000, mp4Box("text", make([]byte, 30)), [][]byte{
+		mp4Box("stts", be32(0, 2, 1, 4000, 1, 6000)),
+		mp4Box("stsz", be32(0, 0, 2, uint32(len(chaps[0])), uint32(len(chaps[1])))),
+		mp4Box("stsc", be32(0, 1, 1, 2, 1)),
+		mp4Box("stco", be32(0, 1, uint32(chapOff))),
+	})
+	moovParts := [][]byte{mp4Box("mvhd", be32(0, 0, 0, 1000, 10000), make([]byte, 80)), vtrak, atrak, strak}
+	if udta != nil {
+		moovParts = append(moovParts, mp4Box("udta", udta))
+	} else {
+		moovParts = append(moovParts, ctrak)
+	}
+	return bytes.Join([][]byte{ftyp, mdat, mp4Box("moov", moovParts...)}, nil)
+}
+
+func TestProbeMP4(t *testing.T) {
+	chpl := mp4Box("chpl", be32(0x01000000, 0), []byte{2},
+		be32(0, 0), []byte{5}, []byte("Intro"),
+		be32(0, 40000000), []byte{4}, []byte("Main"),
+	)
+	tracks := func(i *Info) *Info {
+		i.Duration = 10
+		i.Video = []VideoTrack{{Track: Track{ID: 1, Codec: "h264", Language: "eng", Default: true}, Width: 1920, Height: 1080, FPS: 25}}
+		i.Audio = []AudioTrack{{Track: Track{ID: 2, Codec: "aac", Language: "eng", Default: true}, Channels: 2, SampleRate: 44100}}
+		i.Subtitles = []SubtitleTrack{{Track: Track{ID: 3, Codec: "mov_text", Language: "eng", Default: true}}}
+		return i
+	}
+	chapters := []Chapter{{Start: 0, End: 4, Title: "Intro"}, {Start: 4, End: 10, Title: "Main"}}
+	tests := []struct {
+		name string
+		data []byte
+		want *Info
+	}{
+		{
+			name: "chapter track",
+			data: mkMP4("isom", nil),
+			want: tracks(&Info{Container: ContainerMP4, Chapters: chapters}),
+		},
+		{
+			name: "nero chapters",
+			data: mkMP4("qt  ", chpl),
+			want: tracks(&Info{Container: ContainerMOV, Chapters: chapters}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Probe(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Probe() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractSubtitleMP4(t *testing.T) {
+	d := mkMP4("isom", nil)
+	got, err := ExtractSubtitle(bytes.NewReader(d), int64(len(d)), 3)
+	if err != nil {
+		t.Fatalf("ExtractSubtitle() error = %v", err)
+	}
+	want := &subconv.Track{Language: "eng", Cues: []subconv.Cue{
+		{Start: 0, End: time.Second, Text: "Hello"},
+		{Start: 3 * time.Second, End: 4500 * time.Millisecond, Text: "World"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractSubtitle() = %+v, want %+v", got, want)
+	}
+	if _, err := ExtractSubtitle(bytes.NewReader(d), int64(len(d)), 1); err != ErrTrackNotFound {
+		t.Errorf("ExtractSubtitle() of video track error = %v, want %v", err, ErrTrackNotFound)
+	}
+}
+
+func TestSampleTable(t *testing.T) {
+	stbl := func(stsz, stts []byte) []byte {
+		return bytes.Join([][]byte{
+			mp4Box("stsz", stsz),
+			mp4Box("stts", stts),
+			mp4Box("stsc", be32(0, 1, 1, 4, 1)),
+			mp4Box("stco", be32(0, 1, 100)),
+		}, nil)
+	}
+	tests := []struct {
+		name string
+		stbl []byte
+		want []mp4Sample
+		err  bool
+	}{
+		{
+			name: "sizes table",
+			stbl: stbl(be32(0, 0, 2, 10, 20), be32(0, 1, 2, 1000)),
+			want: []mp4Sample{{offset: 100, size: 10, start: 0, duration: 1000}, {offset: 110, size: 20, start: 1000, duration: 1000}},
+		},
+		{
+			name: "count past truncated sizes table",
+			stbl: stbl(be32(0, 0, 0xFFFFFFFF, 10, 20), be32(0, 1, 2, 1000)),
+			want: []mp4Sample{{offset: 100, size: 10, start: 0, duration: 1000}, {offset: 110, size: 20, start: 1000, duration: 1000}},
+		},
+		{
+			name: "fixed size count past time table",
+			stbl: stbl(be32(0, 8, 0xFFFFFFFF), be32(0, 1, 2, 500)),
+			want: []mp4Sample{{offset: 100, size: 8, start: 0, duration: 500}, {offset: 108, size: 8, start: 500, duration: 500}},
+		},
+		{
+			name: "too many samples",
+			stbl: stbl(be32(0, 8, 0xFFFFFFFF), be32(0, 2, 0xFFFFFFFF, 1, 0xFFFFFFFF, 1)),
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&mp4Track{stbl: tt.stbl}).sampleTable()
+			if (err != nil) != tt.err {
+				t.Fatalf("sampleTable() error = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sampleTable() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTx3gText(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "utf-8", data: tx3gSample("Привет"), want: "Привет"},
+		{name: "utf-16", data: []byte{0, 6, 0xFE, 0xFF, 0, 'H', 0, 'i'}, want: "Hi"},
+		{name: "length past data", data: []byte{0, 9, 'a'}, want: "a"},
+		{name: "empty", data: []byte{0}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tx3gText(tt.data); got != tt.want {
+				t.Errorf("tx3gText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
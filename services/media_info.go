@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/webtor-io/video-info/services/media"
+	"github.com/webtor-io/video-info/services/redis"
+	"github.com/webtor-io/video-info/services/retry"
+
+	"github.com/pkg/errors"
+)
+
+type MediaInfo struct {
+	url    string
+	cache  *redis.Cache
+	retry  *retry.Policy
+	value  *media.Info
+	inited bool
+	err    error
+	mux    sync.Mutex
+}
+
+func NewMediaInfo(url string, c *redis.Cache, r *retry.Policy) *MediaInfo {
+	return &MediaInfo{url: url, cache: c, retry: r}
+}
+
+// errProbeFailed is returned while previous probe failure is cached
+var errProbeFailed = errors.New("media probe failed recently")
+
+func (s *MediaInfo) get(ctx context.Context, purge bool) (*media.Info, error) {
+	if !purge {
+		info, err := s.cache.GetMediaInfo(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get media info from cache")
+		}
+		// empty info marks failed probe
+		if info != nil && info.Container == "" {
+			return nil, errProbeFailed
+		}
+		if info != nil {
+			return info, nil
+		}
+	}
+	info, err := s.probe(ctx)
+	if err != nil {
+		// cancelled request tells nothing about the source
+		if ctx.Err() == nil {
+			if err := s.cache.SetMediaInfoFailure(ctx); err != nil {
+				return nil, errors.Wrap(err, "failed to store media info failure in cache")
+			}
+		}
+		return nil, err
+	}
+	err = s.cache.SetMediaInfo(ctx, info)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to store media info in cache")
+	}
+	return info, nil
+}
+
+func (s *MediaInfo) probe(ctx context.Context) (*media.Info, error) {
+	r := newSourceRangeReader(ctx, s.url, s.retry)
+	size, err := r.Size()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read size")
+	}
+	info, err := media.Probe(r, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to probe media")
+	}
+	return info, nil
+}
+
+func (s *MediaInfo) Get(ctx context.Context, purge bool) (*media.Info, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if purge {
+		s.inited = false
+	}
+	if s.inited {
+		return s.value, s.err
+	}
+	s.value, s.err = s.get(ctx, purge)
+	s.inited = true
+	return s.value, s.err
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/webtor-io/video-info/services/media"
+	"github.com/webtor-io/video-info/services/redis"
+	"github.com/webtor-io/video-info/services/retry"
+)
+
+type MediaInfoPool struct {
+	sm    sync.Map
+	retry *retry.Policy
+}
+
+func NewMediaInfoPool(r *retry.Policy) *MediaInfoPool {
+	return &MediaInfoPool{retry: r}
+}
+
+func (s *MediaInfoPool) Get(ctx context.Context, url string, c *redis.Cache, purge bool) (*media.Info, error) {
+	v, loaded := s.sm.LoadOrStore(url, NewMediaInfo(url, c, s.retry))
+	if !loaded {
+		defer s.sm.Delete(url)
+	}
+	return v.(*MediaInfo).Get(ctx, purge)
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/webtor-io/video-info/services/osdb"
+)
+
+const (
+	OpenSubtitlesProviderName = "opensubtitles"
+)
+
+type OpenSubtitlesProvider struct {
+	cl *osdb.Client
+}
+
+func NewOpenSubtitlesProvider(cl *osdb.Client) *OpenSubtitlesProvider {
+	return &OpenSubtitlesProvider{cl: cl}
+}
+
+func (s *OpenSubtitlesProvider) Name() string {
+	return OpenSubtitlesProviderName
+}
+
+func (s *OpenSubtitlesProvider) SearchByHash(ctx context.Context, hash uint64, _ int64, languages []string) ([]osdb.Subtitle, error) {
+	return s.cl.SearchSubtitlesByHash(ctx, fmt.Sprintf("%x", hash), languages)
+}
+
+func (s *OpenSubtitlesProvider) SearchByIMDB(ctx context.Context, imdbID string, languages []string) ([]osdb.Subtitle, error) {
+	return s.cl.SearchSubtitlesByIMDB(ctx, imdbID, languages)
+}
+
+func (s *OpenSubtitlesProvider) SearchByQuery(ctx context.Context, q osdb.Query, languages []string) ([]osdb.Subtitle, error) {
+	return s.cl.SearchSubtitlesByQuery(ctx, q, languages)
+}
+
+func (s *OpenSubtitlesProvider) Quotas() []osdb.Quota {
+	return s.cl.Quotas()
+}
+
+func (s *OpenSubtitlesProvider) Available() bool {
+	return s.cl.Available()
+}
+
+func (s *OpenSubtitlesProvider) Download(ctx context.Context, _ *osdb.Subtitle, fileID int) ([]byte, error) {
+	return s.cl.DownloadSubtitle(ctx, fileID, "")
+}
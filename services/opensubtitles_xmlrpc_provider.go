@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/webtor-io/video-info/services/osdb"
+)
+
+const (
+	OpenSubtitlesXMLRPCProviderName = "opensubtitles-xmlrpc"
+)
+
+// OpenSubtitlesXMLRPCProvider uses legacy OpenSubtitles API, it is meant to
+// be enabled after OpenSubtitlesProvider as a fallback. Legacy API searches
+// all languages when none of requested ones is known to it, so results are
+// filtered once again.
+type OpenSubtitlesXMLRPCProvider struct {
+	cl *osdb.XMLRPCClient
+}
+
+func NewOpenSubtitlesXMLRPCProvider(cl *osdb.XMLRPCClient) *OpenSubtitlesXMLRPCProvider {
+	return &OpenSubtitlesXMLRPCProvider{cl: cl}
+}
+
+func (s *OpenSubtitlesXMLRPCProvider) Name() string {
+	return OpenSubtitlesXMLRPCProviderName
+}
+
+func (s *OpenSubtitlesXMLRPCProvider) SearchByHash(ctx context.Context, hash uint64, size int64, languages []string) ([]osdb.Subtitle, error) {
+	subs, err := s.cl.SearchSubtitlesByHash(ctx, fmt.Sprintf("%x", hash), size, languages)
+	return filterByLanguages(subs, languages), err
+}
+
+func (s *OpenSubtitlesXMLRPCProvider) SearchByIMDB(ctx context.Context, imdbID string, languages []string) ([]osdb.Subtitle, error) {
+	subs, err := s.cl.SearchSubtitlesByIMDB(ctx, imdbID, languages)
+	return filterByLanguages(subs, languages), err
+}
+
+func (s *OpenSubtitlesXMLRPCProvider) SearchByQuery(ctx context.Context, q osdb.Query, languages []string) ([]osdb.Subtitle, error) {
+	subs, err := s.cl.SearchSubtitlesByQuery(ctx, q, languages)
+	return filterByLanguages(subs, languages), err
+}
+
+func (s *OpenSubtitlesXMLRPCProvider) Quotas() []osdb.Quota {
+	return s.cl.Quotas()
+}
+
+func (s *OpenSubtitlesXMLRPCProvider) Available() bool {
+	return s.cl.Available()
+}
+
+func (s *OpenSubtitlesXMLRPCProvider) Download(ctx context.Context, _ *osdb.Subtitle, fileID int) ([]byte, error) {
+	return s.cl.DownloadSubtitle(ctx, fileID)
+}
@@ -0,0 +1,149 @@
+package osdb
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// account holds token and download quota of single OpenSubtitles user.
+type account struct {
+	user    string
+	pass    string
+	token   string
+	expires time.Time
+	apiURL  string
+	mux     sync.Mutex
+	quota   quotaTracker
+}
+
+// invalidateToken drops token unless it was already replaced with a new one,
+// so concurrent requests rejected with the same token cause single login.
+func (a *account) invalidateToken(token string) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.token == token {
+		a.token = ""
+	}
+}
+
+// loadAccounts collects credentials from user/pass flags, accounts flag and
+// accounts file. Without any credentials single anonymous account is used.
+func loadAccounts(c *cli.Context) ([]*account, error) {
+	var creds []string
+	if c.String(OsdbUser) != "" {
+		creds = append(creds, c.String(OsdbUser)+":"+c.String(OsdbPass))
+	}
+	creds = append(creds, splitAccounts(c.String(OsdbAccountsFlag))...)
+	if p := c.String(OsdbAccountsFileFlag); p != "" {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open accounts file")
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			creds = append(creds, sc.Text())
+		}
+		if err := sc.Err(); err != nil {
+			return nil, errors.Wrap(err, "failed to read accounts file")
+		}
+	}
+	var res []*account
+	seen := map[string]bool{}
+	for _, cr := range creds {
+		cr = strings.TrimSpace(cr)
+		if cr == "" || strings.HasPrefix(cr, "#") {
+			continue
+		}
+		user, pass, ok := strings.Cut(cr, ":")
+		if !ok {
+			return nil, errors.Errorf("account %v has no password, user:pass expected", user)
+		}
+		if seen[user] {
+			continue
+		}
+		seen[user] = true
+		res = append(res, &account{user: user, pass: pass})
+	}
+	if len(res) == 0 {
+		res = append(res, &account{})
+	}
+	return res, nil
+}
+
+// splitAccounts splits comma separated user:pass list. Comma separates
+// accounts only when it is followed by the next user:pass pair, otherwise it
+// belongs to the password.
+func splitAccounts(s string) []string {
+	var res []string
+	for _, p := range strings.Split(s, ",") {
+		if len(res) > 0 && !strings.Contains(p, ":") {
+			res[len(res)-1] += "," + p
+			continue
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+// pickAccount returns account with the most remaining downloads skipping
+// exhausted and already tried ones. Accounts with unknown quota go first so
+// their quota gets known. If every account is exhausted the error tells when
+// the earliest one resets.
+func (s *Client) pickAccount(tried map[*account]bool) (*account, error) {
+	var best *account
+	bestRemaining := -1
+	var qe *QuotaError
+	for _, a := range s.accounts {
+		if err := a.quota.check(); err != nil {
+			if e := err.(*QuotaError); qe == nil || e.ResetAt.Before(qe.ResetAt) {
+				qe = e
+			}
+			continue
+		}
+		if tried[a] {
+			continue
+		}
+		q := a.quota.get()
+		remaining := q.Remaining
+		if q.UpdatedAt.IsZero() || (!q.ResetAt.IsZero() && time.Now().After(q.ResetAt)) {
+			remaining = math.MaxInt32
+		}
+		if remaining > bestRemaining {
+			best = a
+			bestRemaining = remaining
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+	if qe != nil {
+		return nil, qe
+	}
+	return nil, errors.New("no accounts left to try")
+}
+
+// Quotas returns download quota of every account.
+func (s *Client) Quotas() []Quota {
+	res := make([]Quota, 0, len(s.accounts))
+	for i, a := range s.accounts {
+		q := a.quota.get()
+		q.Account = accountLabel(i)
+		res = append(res, q)
+	}
+	return res
+}
+
+// accountLabel names account by its position in configuration, so quota can
+// be published without exposing usernames.
+func accountLabel(i int) string {
+	return "account-" + strconv.Itoa(i+1)
+}
@@ -0,0 +1,159 @@
+package osdb
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+func accountsContext(t *testing.T, args ...string) *cli.Context {
+	t.Helper()
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range []string{OsdbUser, OsdbPass, OsdbAccountsFlag, OsdbAccountsFileFlag} {
+		set.String(f, "", "")
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cli.NewContext(nil, set, nil)
+}
+
+func TestSplitAccounts(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: "", want: []string{""}},
+		{value: "a:1,b:2", want: []string{"a:1", "b:2"}},
+		{value: "a:1,2,3,b:x,y", want: []string{"a:1,2,3", "b:x,y"}},
+		{value: "a:p:w,b:2", want: []string{"a:p:w", "b:2"}},
+	}
+	for _, tt := range tests {
+		if got := splitAccounts(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitAccounts(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLoadAccounts(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "accounts")
+	if err := os.WriteFile(file, []byte("# comment\nc:3,x\n\n a:dup \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args []string
+		want [][2]string
+		err  bool
+	}{
+		{name: "anonymous", want: [][2]string{{"", ""}}},
+		{
+			name: "user and accounts",
+			args: []string{"--" + OsdbUser, "a", "--" + OsdbPass, "1", "--" + OsdbAccountsFlag, "b:2,with,commas, c:3"},
+			want: [][2]string{{"a", "1"}, {"b", "2,with,commas"}, {"c", "3"}},
+		},
+		{
+			name: "accounts file",
+			args: []string{"--" + OsdbAccountsFlag, "a:1", "--" + OsdbAccountsFileFlag, file},
+			want: [][2]string{{"a", "1"}, {"c", "3,x"}},
+		},
+		{name: "no password", args: []string{"--" + OsdbAccountsFlag, "a"}, err: true},
+		{name: "missing file", args: []string{"--" + OsdbAccountsFileFlag, file + ".missing"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts, err := loadAccounts(accountsContext(t, tt.args...))
+			if (err != nil) != tt.err {
+				t.Fatalf("loadAccounts() error = %v, want error %v", err, tt.err)
+			}
+			var got [][2]string
+			for _, a := range accounts {
+				got = append(got, [2]string{a.user, a.pass})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadAccounts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotaTracker(t *testing.T) {
+	var q quotaTracker
+	if err := q.check(); err != nil {
+		t.Fatalf("check() of unknown quota error = %v", err)
+	}
+	q.update(&SubtitleDownloadResponse{Remaining: 5, ResetTimeUtc: time.Now().Add(time.Hour)})
+	if err := q.check(); err != nil {
+		t.Fatalf("check() of remaining quota error = %v", err)
+	}
+	// reset time in the past falls back to fixed duration
+	qe := q.exhaust(&SubtitleDownloadResponse{Message: "exhausted"}, time.Hour)
+	if time.Until(qe.ResetAt) < 59*time.Minute {
+		t.Errorf("exhaust() reset at %v, want fallback in an hour", qe.ResetAt)
+	}
+	var err *QuotaError
+	if !errors.As(q.check(), &err) || err.Message != "exhausted" {
+		t.Errorf("check() of exhausted quota error = %v, want quota error", q.check())
+	}
+	q.exhaust(&SubtitleDownloadResponse{ResetTimeUtc: time.Now().Add(time.Millisecond)}, time.Hour)
+	time.Sleep(2 * time.Millisecond)
+	if err := q.check(); err != nil {
+		t.Errorf("check() after reset error = %v", err)
+	}
+}
+
+func TestPickAccount(t *testing.T) {
+	remaining := func(n int) *account {
+		a := &account{user: "remaining"}
+		a.quota.update(&SubtitleDownloadResponse{Remaining: n, ResetTimeUtc: time.Now().Add(time.Hour)})
+		return a
+	}
+	exhausted := func(reset time.Duration) *account {
+		a := &account{user: "exhausted"}
+		a.quota.exhaust(&SubtitleDownloadResponse{ResetTimeUtc: time.Now().Add(reset)}, time.Hour)
+		return a
+	}
+	unknown := &account{user: "unknown"}
+	few, many := remaining(1), remaining(9)
+	soon, late := exhausted(time.Minute), exhausted(time.Hour)
+	tests := []struct {
+		name     string
+		accounts []*account
+		tried    []*account
+		want     *account
+		resetAt  time.Time
+	}{
+		{name: "unknown quota first", accounts: []*account{many, unknown}, want: unknown},
+		{name: "most remaining", accounts: []*account{few, many, soon}, want: many},
+		{name: "tried are skipped", accounts: []*account{few, many}, tried: []*account{many}, want: few},
+		{name: "earliest reset when exhausted", accounts: []*account{late, soon}, resetAt: soon.quota.get().ResetAt},
+		{name: "everything tried", accounts: []*account{few}, tried: []*account{few}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tried := map[*account]bool{}
+			for _, a := range tt.tried {
+				tried[a] = true
+			}
+			got, err := (&Client{accounts: tt.accounts}).pickAccount(tried)
+			if got != tt.want {
+				t.Errorf("pickAccount() = %v, want %v", got, tt.want)
+			}
+			var qe *QuotaError
+			switch {
+			case tt.want != nil && err != nil:
+				t.Errorf("pickAccount() error = %v", err)
+			case tt.want == nil && err == nil:
+				t.Errorf("pickAccount() error = nil, want error")
+			case !tt.resetAt.IsZero() && (!errors.As(err, &qe) || !qe.ResetAt.Equal(tt.resetAt)):
+				t.Errorf("pickAccount() error = %v, want quota error reset at %v", err, tt.resetAt)
+			}
+		})
+	}
+}
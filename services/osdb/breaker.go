@@ -0,0 +1,177 @@
+package osdb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"github.com/webtor-io/video-info/services/retry"
+)
+
+const (
+	OsdbBreakerFailuresFlag = "osdb-breaker-failures"
+	OsdbBreakerCooldownFlag = "osdb-breaker-cooldown"
+)
+
+func RegisterBreakerFlags(f []cli.Flag) []cli.Flag {
+	return append(f,
+		cli.IntFlag{
+			Name:   OsdbBreakerFailuresFlag,
+			Usage:  "consecutive osdb failures opening circuit breaker, 0 disables it",
+			Value:  5,
+			EnvVar: "OSDB_BREAKER_FAILURES",
+		},
+		cli.DurationFlag{
+			Name:   OsdbBreakerCooldownFlag,
+			Usage:  "time circuit breaker stays open before probing osdb again",
+			Value:  30 * time.Second,
+			EnvVar: "OSDB_BREAKER_COOLDOWN",
+		},
+	)
+}
+
+// CircuitOpenError is returned without calling osdb while it is considered down.
+type CircuitOpenError struct {
+	ResetAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("osdb circuit breaker is open until %v", e.ResetAt.Format(time.RFC3339))
+}
+
+// RetryAfter returns time left before osdb is probed again.
+func (e *CircuitOpenError) RetryAfter() time.Duration {
+	d := time.Until(e.ResetAt)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// Breaker stops calling osdb after consecutive failures. When cooldown is
+// over single probe call is let through, it closes breaker on success and
+// opens it again on failure.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	mux       sync.Mutex
+}
+
+func NewBreaker(c *cli.Context) *Breaker {
+	return &Breaker{
+		threshold: c.Int(OsdbBreakerFailuresFlag),
+		cooldown:  c.Duration(OsdbBreakerCooldownFlag),
+	}
+}
+
+// Do calls fn if breaker lets it through and records its outcome.
+func (s *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s == nil || s.threshold <= 0 {
+		return fn(ctx)
+	}
+	if err := s.allow(); err != nil {
+		return err
+	}
+	err := fn(ctx)
+	s.record(err)
+	return err
+}
+
+// Down tells whether calls are refused now. It is false when cooldown is
+// over, so the next call probes osdb.
+func (s *Breaker) Down() bool {
+	if s == nil || s.threshold <= 0 {
+		return false
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	switch s.state {
+	case breakerOpen:
+		return time.Now().Before(s.openedAt.Add(s.cooldown))
+	case breakerHalfOpen:
+		return true
+	}
+	return false
+}
+
+func (s *Breaker) allow() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	switch s.state {
+	case breakerOpen:
+		resetAt := s.openedAt.Add(s.cooldown)
+		if time.Now().Before(resetAt) {
+			return &CircuitOpenError{ResetAt: resetAt}
+		}
+		log.Info("osdb circuit breaker is half-open, probing")
+		s.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		return &CircuitOpenError{ResetAt: time.Now().Add(s.cooldown)}
+	}
+	return nil
+}
+
+func (s *Breaker) record(err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	// canceled call tells nothing, so next call probes again
+	if errors.Is(err, context.Canceled) {
+		if s.state == breakerHalfOpen {
+			s.state = breakerOpen
+		}
+		return
+	}
+	if !isOutage(err) {
+		if s.state != breakerClosed {
+			log.Info("osdb circuit breaker closed")
+		}
+		s.state = breakerClosed
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if s.state == breakerHalfOpen || s.failures >= s.threshold {
+		if s.state != breakerOpen {
+			log.WithError(err).WithField("failures", s.failures).Warn("osdb circuit breaker opened")
+		}
+		s.state = breakerOpen
+		s.openedAt = time.Now()
+	}
+}
+
+// isOutage tells whether error means osdb is unavailable, any response
+// including quota, rate limit and client errors proves it is alive.
+func isOutage(err error) bool {
+	if err == nil || isRateLimited(err) {
+		return false
+	}
+	return retry.Retryable(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// isRateLimited tells whether osdb refused request with 429.
+func isRateLimited(err error) bool {
+	var he *retry.HTTPError
+	if errors.As(err, &he) {
+		return he.Code == http.StatusTooManyRequests
+	}
+	var se *xmlrpcStatusError
+	return errors.As(err, &se) && strings.HasPrefix(se.status, "429")
+}
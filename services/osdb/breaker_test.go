@@ -0,0 +1,168 @@
+package osdb
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/webtor-io/video-info/services/retry"
+)
+
+func statusError(code int) error {
+	return errors.Wrap(retry.NewHTTPError(&http.Response{StatusCode: code, Header: http.Header{}}, nil), "failed")
+}
+
+func TestIsOutage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "server error", err: statusError(503), want: true},
+		{name: "deadline", err: errors.Wrap(context.DeadlineExceeded, "failed"), want: true},
+		{name: "rate limit", err: statusError(429), want: false},
+		{name: "xml-rpc rate limit", err: &xmlrpcStatusError{status: "429 Too many requests"}, want: false},
+		{name: "xml-rpc server error", err: &xmlrpcStatusError{status: "503 Backend fetch failed"}, want: true},
+		{name: "client error", err: statusError(404), want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isOutage(tt.err); got != tt.want {
+				t.Errorf("isOutage(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// call calls breaker with fn returning err and tells whether fn was called.
+func call(b *Breaker, err error) (bool, error) {
+	called := false
+	res := b.Do(context.Background(), func(ctx context.Context) error {
+		called = true
+		return err
+	})
+	return called, res
+}
+
+func TestBreaker(t *testing.T) {
+	type step struct {
+		err    error
+		called bool
+		state  breakerState
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "opens after consecutive failures",
+			steps: []step{
+				{err: statusError(503), called: true, state: breakerClosed},
+				{err: statusError(503), called: true, state: breakerOpen},
+				{err: nil, called: false, state: breakerOpen},
+			},
+		},
+		{
+			name: "success resets failures",
+			steps: []step{
+				{err: statusError(503), called: true, state: breakerClosed},
+				{err: nil, called: true, state: breakerClosed},
+				{err: statusError(503), called: true, state: breakerClosed},
+			},
+		},
+		{
+			name: "client errors and rate limit prove osdb is alive",
+			steps: []step{
+				{err: statusError(503), called: true, state: breakerClosed},
+				{err: statusError(429), called: true, state: breakerClosed},
+				{err: statusError(503), called: true, state: breakerClosed},
+				{err: statusError(404), called: true, state: breakerClosed},
+			},
+		},
+		{
+			name: "canceled call is not counted",
+			steps: []step{
+				{err: statusError(503), called: true, state: breakerClosed},
+				{err: context.Canceled, called: true, state: breakerClosed},
+				{err: statusError(503), called: true, state: breakerOpen},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Breaker{threshold: 2, cooldown: time.Hour}
+			for i, s := range tt.steps {
+				called, err := call(b, s.err)
+				if called != s.called {
+					t.Fatalf("step %v: called = %v, want %v", i, called, s.called)
+				}
+				var ce *CircuitOpenError
+				if !called && !errors.As(err, &ce) {
+					t.Fatalf("step %v: error = %v, want circuit open error", i, err)
+				}
+				if b.state != s.state {
+					t.Fatalf("step %v: state = %v, want %v", i, b.state, s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		state breakerState
+		down  bool
+	}{
+		{name: "success closes", err: nil, state: breakerClosed, down: false},
+		{name: "failure opens again", err: statusError(503), state: breakerOpen, down: true},
+		{name: "canceled probe opens and lets next probe through", err: context.Canceled, state: breakerOpen, down: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Breaker{threshold: 1, cooldown: time.Minute}
+			call(b, statusError(503))
+			if !b.Down() {
+				t.Fatalf("Down() = false after failure, want true")
+			}
+			// cooldown is over
+			b.openedAt = time.Now().Add(-time.Minute)
+			if b.Down() {
+				t.Fatalf("Down() = true after cooldown, want false")
+			}
+			err := b.Do(context.Background(), func(ctx context.Context) error {
+				if b.state != breakerHalfOpen || !b.Down() {
+					t.Errorf("state = %v during probe, want half-open", b.state)
+				}
+				if called, _ := call(b, nil); called {
+					t.Errorf("concurrent call is let through during probe")
+				}
+				return tt.err
+			})
+			if err != tt.err {
+				t.Errorf("Do() error = %v, want %v", err, tt.err)
+			}
+			if b.state != tt.state || b.Down() != tt.down {
+				t.Errorf("state = %v, down = %v, want %v, %v", b.state, b.Down(), tt.state, tt.down)
+			}
+		})
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	for _, b := range []*Breaker{nil, {threshold: 0}} {
+		for i := 0; i < 3; i++ {
+			if called, _ := call(b, statusError(503)); !called {
+				t.Fatalf("disabled breaker refused call")
+			}
+		}
+		if b.Down() {
+			t.Errorf("Down() = true for disabled breaker")
+		}
+	}
+}
@@ -6,22 +6,27 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"github.com/webtor-io/video-info/services/retry"
 	"io"
 	"net/http"
-	"sync"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Client struct {
-	apiKey string
-	apiURL string
-	apiUA  string
-	user   string
-	pass   string
-	cl     *http.Client
-	token  string
-	mux    sync.Mutex
+	apiKey   string
+	apiURL   string
+	apiUA    string
+	accounts []*account
+	cl       *http.Client
+	maxPages int
+	retry    *retry.Policy
+	breaker  *Breaker
 }
 
 const (
@@ -30,6 +35,9 @@ const (
 	OsdbApiURLFlag       = "osdb-api-url"
 	OsdbUser             = "osdb-user"
 	OsdbPass             = "osdb-pass"
+	OsdbMaxPagesFlag     = "osdb-max-pages"
+	OsdbAccountsFlag     = "osdb-accounts"
+	OsdbAccountsFileFlag = "osdb-accounts-file"
 )
 
 func RegisterOSDBClientFlags(f []cli.Flag) []cli.Flag {
@@ -64,38 +72,64 @@ func RegisterOSDBClientFlags(f []cli.Flag) []cli.Flag {
 			Value:  "",
 			EnvVar: "OSDB_PASS",
 		},
+		cli.StringFlag{
+			Name:   OsdbAccountsFlag,
+			Usage:  "comma separated osdb accounts (user:pass), used in addition to osdb user",
+			Value:  "",
+			EnvVar: "OSDB_ACCOUNTS",
+		},
+		cli.StringFlag{
+			Name:   OsdbAccountsFileFlag,
+			Usage:  "file with osdb accounts, one user:pass per line",
+			Value:  "",
+			EnvVar: "OSDB_ACCOUNTS_FILE",
+		},
+		cli.IntFlag{
+			Name:   OsdbMaxPagesFlag,
+			Usage:  "max number of search result pages to fetch",
+			Value:  10,
+			EnvVar: "OSDB_MAX_PAGES",
+		},
 	)
 }
 
-func NewClient(c *cli.Context, cl *http.Client) *Client {
-	return &Client{
-		apiKey: c.String(OsdbApiKeyFlag),
-		apiUA:  c.String(OsdbApiUserAgentFlag),
-		apiURL: c.String(OsdbApiURLFlag),
-		user:   c.String(OsdbUser),
-		pass:   c.String(OsdbPass),
-		cl:     cl,
+func NewClient(c *cli.Context, cl *http.Client, r *retry.Policy, b *Breaker) (*Client, error) {
+	accounts, err := loadAccounts(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load osdb accounts")
 	}
+	return &Client{
+		apiKey:   c.String(OsdbApiKeyFlag),
+		apiUA:    c.String(OsdbApiUserAgentFlag),
+		apiURL:   c.String(OsdbApiURLFlag),
+		accounts: accounts,
+		cl:       cl,
+		maxPages: c.Int(OsdbMaxPagesFlag),
+		retry:    r,
+		breaker:  b,
+	}, nil
 }
 
-func (s *Client) getToken(ctx context.Context) (token string, err error) {
-	s.mux.Lock()
-	defer s.mux.Unlock()
-	if s.token != "" {
-		return s.token, nil
+// getToken returns cached token of the account or logs in with it. Api url
+// of the account is taken from login response.
+func (s *Client) getToken(ctx context.Context, a *account) (token string, apiURL string, err error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.token != "" && time.Now().Before(a.expires) {
+		return a.token, a.apiURL, nil
 	}
 	u := fmt.Sprintf("%v/login", s.apiURL)
 	lr := &LoginRequest{
-		Username: s.user,
-		Password: s.pass,
+		Username: a.user,
+		Password: a.pass,
 	}
 	rb, err := json.Marshal(lr)
 	if err != nil {
-		return "", errors.Wrapf(err, "failed to marshal object=%+v", lr)
+		return "", "", errors.Wrapf(err, "failed to marshal object=%+v", lr)
 	}
 	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewBuffer(rb))
 	if err != nil {
-		return "", errors.Wrap(err, "failed to make new login request")
+		return "", "", errors.Wrap(err, "failed to make new login request")
 	}
 	req = s.prepareRequest(req)
 	//rd, _ := httputil.DumpRequest(req, true)
@@ -104,35 +138,85 @@ func (s *Client) getToken(ctx context.Context) (token string, err error) {
 	//red, _ := httputil.DumpResponse(res, true)
 	//log.Info(string(red))
 	if err != nil {
-		return "", errors.Wrap(err, "failed to do login request")
+		return "", "", errors.Wrap(err, "failed to do login request")
 	}
 	b := res.Body
 	defer b.Close()
 	d, err := io.ReadAll(b)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to read login data")
+		return "", "", errors.Wrap(err, "failed to read login data")
 	}
 	if res.StatusCode != 200 {
-		return "", errors.Errorf("got bad status code on download request code=%v with body=%v", res.StatusCode, string(d))
+		return "", "", errors.Errorf("got bad status code on download request code=%v with body=%v", res.StatusCode, string(d))
 	}
 	lre := LoginResponse{}
 	err = json.Unmarshal(d, &lre)
 
 	if err != nil {
-		return "", errors.Wrapf(err, "failed to unmarshal data=%v", string(d))
+		return "", "", errors.Wrapf(err, "failed to unmarshal data=%v", string(d))
 	}
-	go func() {
-		<-time.After(time.Hour)
-		s.mux.Lock()
-		defer s.mux.Unlock()
-		s.token = ""
-	}()
-	s.token = lre.Token
-	return s.token, nil
+	a.token = lre.Token
+	a.expires = tokenExpiry(lre.Token)
+	a.apiURL = baseURL(s.apiURL, lre.BaseUrl)
+	return a.token, a.apiURL, nil
+}
+
+// Available tells whether osdb is not known to be down.
+func (s *Client) Available() bool {
+	return !s.breaker.Down()
 }
 
-func (s *Client) SearchSubtitles(ctx context.Context, u string) (subs []Subtitle, err error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+func (s *Client) SearchSubtitles(ctx context.Context, q url.Values, languages []string) (subs []Subtitle, err error) {
+	err = s.breaker.Do(ctx, func(ctx context.Context) (err error) {
+		subs, err = s.searchSubtitles(ctx, s.searchURL(s.searchAPIURL(ctx), q, languages))
+		return
+	})
+	return
+}
+
+// searchAPIURL returns api url of the account taken from login response, so
+// search goes to the same host as downloads. Falls back to configured api url
+// without credentials or if login fails.
+func (s *Client) searchAPIURL(ctx context.Context) string {
+	a := s.accounts[0]
+	if a.user == "" {
+		return s.apiURL
+	}
+	_, u, err := s.getToken(ctx, a)
+	if err != nil {
+		log.WithError(err).WithField("account", a.user).Warn("failed to get osdb api url, using default")
+		return s.apiURL
+	}
+	return u
+}
+
+func (s *Client) searchSubtitles(ctx context.Context, u string) (subs []Subtitle, err error) {
+	for page := 1; ; page++ {
+		var sr *SubtitleSearchResponse
+		err := s.retry.Do(ctx, "osdb_search", func(ctx context.Context) (err error) {
+			sr, err = s.searchSubtitlesPage(ctx, u, page)
+			return
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get page=%v", page)
+		}
+		subs = append(subs, sr.Data...)
+		if page >= sr.TotalPages || (s.maxPages > 0 && page >= s.maxPages) {
+			break
+		}
+	}
+	return
+}
+
+func (s *Client) searchSubtitlesPage(ctx context.Context, u string, page int) (*SubtitleSearchResponse, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse url=%v", u)
+	}
+	q := pu.Query()
+	q.Set("page", strconv.Itoa(page))
+	pu.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", pu.String(), nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to make new request")
 	}
@@ -147,26 +231,46 @@ func (s *Client) SearchSubtitles(ctx context.Context, u string) (subs []Subtitle
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to read data")
 	}
+	if res.StatusCode != 200 {
+		return nil, errors.Wrap(retry.NewHTTPError(res, data), "got bad status code on search request")
+	}
 	sr := SubtitleSearchResponse{}
 	err = json.Unmarshal(data, &sr)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to unmarshal data=%v", string(data))
 	}
-	subs = sr.Data
-	return
+	return &sr, nil
 }
 
-func (s *Client) SearchSubtitlesByIMDB(ctx context.Context, id string) (subs []Subtitle, err error) {
-	u := fmt.Sprintf("%v/subtitles?imdb_id=%v", s.apiURL, id)
-	return s.SearchSubtitles(ctx, u)
+func (s *Client) SearchSubtitlesByIMDB(ctx context.Context, id string, languages []string) (subs []Subtitle, err error) {
+	q := url.Values{}
+	q.Set("imdb_id", id)
+	return s.SearchSubtitles(ctx, q, languages)
 }
 
-func (s *Client) SearchSubtitlesByHash(ctx context.Context, hash string) (subs []Subtitle, err error) {
+func (s *Client) SearchSubtitlesByHash(ctx context.Context, hash string, languages []string) (subs []Subtitle, err error) {
 	for i := 0; i < 16-len(hash); i++ {
 		hash = "0" + hash
 	}
-	u := fmt.Sprintf("%v/subtitles?moviehash=%v", s.apiURL, hash)
-	return s.SearchSubtitles(ctx, u)
+	q := url.Values{}
+	q.Set("moviehash", hash)
+	return s.SearchSubtitles(ctx, q, languages)
+}
+
+func (s *Client) SearchSubtitlesByQuery(ctx context.Context, q Query, languages []string) (subs []Subtitle, err error) {
+	return s.SearchSubtitles(ctx, q.Values(), languages)
+}
+
+func (s *Client) searchURL(apiURL string, q url.Values, languages []string) string {
+	if len(languages) > 0 {
+		l := make([]string, len(languages))
+		for i, v := range languages {
+			l[i] = strings.ToLower(v)
+		}
+		sort.Strings(l)
+		q.Set("languages", strings.Join(l, ","))
+	}
+	return fmt.Sprintf("%v/subtitles?%v", apiURL, q.Encode())
 }
 
 func (s *Client) prepareRequest(req *http.Request) *http.Request {
@@ -177,50 +281,125 @@ func (s *Client) prepareRequest(req *http.Request) *http.Request {
 	return req
 }
 
+// DownloadSubtitle downloads subtitle with account having the most remaining
+// downloads, accounts which hit the quota are skipped until their reset time.
 func (s *Client) DownloadSubtitle(ctx context.Context, id int, format string) (d []byte, err error) {
-	u := fmt.Sprintf("%v/download", s.apiURL)
-	sdr := &SubtitleDownloadRequest{
-		FileID:    id,
-		SubFormat: format,
+	err = s.breaker.Do(ctx, func(ctx context.Context) (err error) {
+		d, err = s.downloadSubtitle(ctx, id, format)
+		return
+	})
+	return
+}
+
+func (s *Client) downloadSubtitle(ctx context.Context, id int, format string) ([]byte, error) {
+	tried := map[*account]bool{}
+	for {
+		a, err := s.pickAccount(tried)
+		if err != nil {
+			return nil, err
+		}
+		d, err := s.download(ctx, a, id, format)
+		var qe *QuotaError
+		if errors.As(err, &qe) {
+			log.WithError(err).WithField("account", a.user).Warn("osdb account quota exceeded")
+			tried[a] = true
+			continue
+		}
+		return d, err
 	}
-	rb, err := json.Marshal(sdr)
+}
+
+// download requests download link and fetches subtitle with it, both steps
+// are retried separately so link fetch failure doesn't consume quota again.
+func (s *Client) download(ctx context.Context, a *account, id int, format string) ([]byte, error) {
+	var link string
+	err := s.retry.Do(ctx, "osdb_download", func(ctx context.Context) (err error) {
+		link, err = s.requestLink(ctx, a, id, format)
+		return
+	})
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to marshal object=%+v", sdr)
+		return nil, err
 	}
-	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewBuffer(rb))
+	var d []byte
+	err = s.retry.Do(ctx, "osdb_download_link", func(ctx context.Context) (err error) {
+		d, err = s.fetchLink(ctx, link)
+		return
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to make new download request")
+		return nil, err
 	}
-	req = s.prepareRequest(req)
-	req, err = s.addToken(ctx, req)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to add token to request")
+	return d, nil
+}
+
+func (s *Client) requestLink(ctx context.Context, a *account, id int, format string) (string, error) {
+	sdr := &SubtitleDownloadRequest{
+		FileID:    id,
+		SubFormat: format,
 	}
-	//rd, _ := httputil.DumpRequest(req, true)
-	//log.Info(string(rd))
-	res, err := s.cl.Do(req)
-	//red, _ := httputil.DumpResponse(res, true)
-	//log.Info(string(red))
+	rb, err := json.Marshal(sdr)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to do download request")
+		return "", errors.Wrapf(err, "failed to marshal object=%+v", sdr)
 	}
-	b := res.Body
-	defer b.Close()
-	dd, err := io.ReadAll(b)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to read download data")
+	var res *http.Response
+	var dd []byte
+	for relogin := true; ; relogin = false {
+		token, apiURL, err := s.getToken(ctx, a)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to get token")
+		}
+		u := fmt.Sprintf("%v/download", apiURL)
+		req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(rb))
+		if err != nil {
+			return "", errors.Wrap(err, "failed to make new download request")
+		}
+		req = s.prepareRequest(req)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %v", token))
+		//rd, _ := httputil.DumpRequest(req, true)
+		//log.Info(string(rd))
+		res, err = s.cl.Do(req)
+		//red, _ := httputil.DumpResponse(res, true)
+		//log.Info(string(red))
+		if err != nil {
+			return "", errors.Wrap(err, "failed to do download request")
+		}
+		dd, err = io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read download data")
+		}
+		if relogin && (res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden) {
+			log.WithField("account", a.user).WithField("code", res.StatusCode).Warn("osdb token rejected, logging in again")
+			a.invalidateToken(token)
+			continue
+		}
+		break
+	}
+	dresp := SubtitleDownloadResponse{}
+	if res.StatusCode == http.StatusNotAcceptable || res.StatusCode == http.StatusTooManyRequests {
+		_ = json.Unmarshal(dd, &dresp)
+		if dresp.Message == "" {
+			dresp.Message = string(dd)
+		}
+		// rate limit reports only Retry-After, daily quota reports reset time
+		fallback := time.Hour
+		if ra := retry.ParseRetryAfter(res.Header.Get("Retry-After")); ra > 0 {
+			fallback = ra
+		}
+		return "", a.quota.exhaust(&dresp, fallback)
 	}
 	if res.StatusCode != 200 {
-		return nil, errors.Errorf("got bad status code on download request code=%v with body=%v", res.StatusCode, string(dd))
+		return "", errors.Wrap(retry.NewHTTPError(res, dd), "got bad status code on download request")
 	}
-	dresp := SubtitleDownloadResponse{}
 	err = json.Unmarshal(dd, &dresp)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to unmarshal download response data=%v", string(dd))
+		return "", errors.Wrapf(err, "failed to unmarshal download response data=%v", string(dd))
 	}
-	dlink := dresp.Link
+	a.quota.update(&dresp)
+	return dresp.Link, nil
+}
 
-	lreq, err := http.NewRequestWithContext(ctx, "GET", dlink, nil)
+func (s *Client) fetchLink(ctx context.Context, link string) ([]byte, error) {
+	lreq, err := http.NewRequestWithContext(ctx, "GET", link, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to make new link request")
 	}
@@ -230,21 +409,12 @@ func (s *Client) DownloadSubtitle(ctx context.Context, id int, format string) (d
 	}
 	lb := lresp.Body
 	defer lb.Close()
-	d, err = io.ReadAll(lb)
+	d, err := io.ReadAll(lb)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to read link data")
 	}
 	if lresp.StatusCode != 200 {
-		return nil, errors.Errorf("got bad status code on link request code=%v with body=%v", lresp.StatusCode, string(d))
-	}
-	return
-}
-
-func (s *Client) addToken(ctx context.Context, req *http.Request) (*http.Request, error) {
-	token, err := s.getToken(ctx)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get token")
+		return nil, errors.Wrap(retry.NewHTTPError(lresp, d), "got bad status code on link request")
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %v", token))
-	return req, nil
+	return d, nil
 }
@@ -0,0 +1,227 @@
+package osdb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func jwt(claims string) string {
+	return "header." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".signature"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	exp := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	tests := []struct {
+		name  string
+		token string
+		min   time.Time
+		max   time.Time
+	}{
+		{
+			name:  "exp claim",
+			token: jwt(fmt.Sprintf(`{"exp":%v}`, exp.Unix())),
+			min:   exp.Add(-tokenSkew),
+			max:   exp.Add(-tokenSkew),
+		},
+		{
+			name:  "padded exp claim",
+			token: strings.Replace(jwt(fmt.Sprintf(`{"exp":%v}`, exp.Unix())), ".signature", "==.signature", 1),
+			min:   exp.Add(-tokenSkew),
+			max:   exp.Add(-tokenSkew),
+		},
+		{
+			name:  "no exp claim",
+			token: jwt(`{"sub":"user"}`),
+			min:   time.Now().Add(tokenTTL - tokenSkew - time.Second),
+			max:   time.Now().Add(tokenTTL - tokenSkew + time.Second),
+		},
+		{
+			name:  "not jwt",
+			token: "opaque",
+			min:   time.Now().Add(tokenTTL - tokenSkew - time.Second),
+			max:   time.Now().Add(tokenTTL - tokenSkew + time.Second),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenExpiry(tt.token); got.Before(tt.min) || got.After(tt.max) {
+				t.Errorf("tokenExpiry() = %v, want within [%v, %v]", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	const api = "https://api.opensubtitles.com/api/v1"
+	tests := []struct {
+		base string
+		want string
+	}{
+		{base: "", want: api},
+		{base: "vip-api.opensubtitles.com", want: "https://vip-api.opensubtitles.com/api/v1"},
+		{base: "vip-api.opensubtitles.com/", want: "https://vip-api.opensubtitles.com/api/v1"},
+		{base: "http://127.0.0.1:8080", want: "http://127.0.0.1:8080/api/v1"},
+	}
+	for _, tt := range tests {
+		if got := baseURL(api, tt.base); got != tt.want {
+			t.Errorf("baseURL(%q) = %v, want %v", tt.base, got, tt.want)
+		}
+	}
+}
+
+// osdbServer fakes login, search and download endpoints of the REST API.
+// Login returns numbered tokens and points to base host if it is set.
+type osdbServer struct {
+	*httptest.Server
+	base     string
+	logins   int
+	searches int
+	// download answers download request made with token
+	download func(token string) int
+	mux      sync.Mutex
+}
+
+func newOSDBServer(t *testing.T) *osdbServer {
+	s := &osdbServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		switch r.URL.Path {
+		case "/api/v1/login":
+			s.logins++
+			json.NewEncoder(w).Encode(LoginResponse{Token: fmt.Sprintf("token-%v", s.logins), BaseUrl: s.base})
+		case "/api/v1/subtitles":
+			s.searches++
+			json.NewEncoder(w).Encode(SubtitleSearchResponse{TotalPages: 1, Data: []Subtitle{{Id: "1"}}})
+		case "/api/v1/download":
+			code := s.download(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+			w.WriteHeader(code)
+			if code == 200 {
+				json.NewEncoder(w).Encode(SubtitleDownloadResponse{Link: "http://" + r.Host + "/file", Remaining: 10})
+			}
+		case "/file":
+			w.Write([]byte("subtitle"))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *osdbServer) client(a *account) *Client {
+	return &Client{apiURL: s.URL + "/api/v1", accounts: []*account{a}, cl: s.Client()}
+}
+
+func TestDownloadRelogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		account  *account
+		download func(token string) int
+		logins   int
+		err      bool
+	}{
+		{
+			name:     "cached token",
+			account:  &account{user: "u", token: "token-0", expires: time.Now().Add(time.Hour)},
+			download: func(token string) int { return 200 },
+			logins:   0,
+		},
+		{
+			name:    "expired token",
+			account: &account{user: "u", token: "token-0", expires: time.Now().Add(-time.Second)},
+			download: func(token string) int {
+				if token == "token-0" {
+					return 401
+				}
+				return 200
+			},
+			logins: 1,
+		},
+		{
+			name:    "rejected token",
+			account: &account{user: "u"},
+			download: func(token string) int {
+				if token == "token-1" {
+					return 401
+				}
+				return 200
+			},
+			logins: 2,
+		},
+		{
+			name:    "forbidden token",
+			account: &account{user: "u"},
+			download: func(token string) int {
+				if token == "token-1" {
+					return 403
+				}
+				return 200
+			},
+			logins: 2,
+		},
+		{
+			name:     "rejected again",
+			account:  &account{user: "u"},
+			download: func(token string) int { return 401 },
+			logins:   2,
+			err:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newOSDBServer(t)
+			srv.download = tt.download
+			if tt.account.token != "" {
+				tt.account.apiURL = srv.URL + "/api/v1"
+			}
+			d, err := srv.client(tt.account).DownloadSubtitle(context.Background(), 1, "srt")
+			if (err != nil) != tt.err {
+				t.Fatalf("DownloadSubtitle() error = %v, want error %v", err, tt.err)
+			}
+			if !tt.err && string(d) != "subtitle" {
+				t.Errorf("DownloadSubtitle() = %q, want %q", d, "subtitle")
+			}
+			if srv.logins != tt.logins {
+				t.Errorf("logins = %v, want %v", srv.logins, tt.logins)
+			}
+		})
+	}
+}
+
+func TestSearchBaseURL(t *testing.T) {
+	login := newOSDBServer(t)
+	base := newOSDBServer(t)
+	login.base = strings.TrimPrefix(base.URL, "http://")
+	tests := []struct {
+		name    string
+		account *account
+		search  *osdbServer
+	}{
+		{name: "anonymous", account: &account{}, search: login},
+		{name: "base url from login", account: &account{user: "u", pass: "p"}, search: base},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searches := tt.search.searches
+			subs, err := login.client(tt.account).SearchSubtitlesByIMDB(context.Background(), "tt1", nil)
+			if err != nil {
+				t.Fatalf("SearchSubtitlesByIMDB() error = %v", err)
+			}
+			if len(subs) != 1 {
+				t.Errorf("SearchSubtitlesByIMDB() = %+v, want single subtitle", subs)
+			}
+			if tt.search.searches != searches+1 {
+				t.Errorf("search was not sent to %v", tt.search.URL)
+			}
+		})
+	}
+}
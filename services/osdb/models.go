@@ -1,6 +1,12 @@
 package osdb
 
-import "time"
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type LoginRequest struct {
 	Username string `json:"username"`
@@ -21,6 +27,49 @@ type LoginResponse struct {
 	Status  int    `json:"status"`
 }
 
+// Query holds search parameters for searching by title, year, season and
+// episode rather than by hash or IMDB id.
+type Query struct {
+	Query        string
+	Year         int
+	Season       int
+	Episode      int
+	ParentIMDBID string
+	TMDBID       string
+}
+
+func (q Query) Empty() bool {
+	return q.Query == "" && q.ParentIMDBID == "" && q.TMDBID == ""
+}
+
+func (q Query) Values() url.Values {
+	v := url.Values{}
+	if q.Query != "" {
+		v.Set("query", strings.ToLower(q.Query))
+	}
+	if q.Year != 0 {
+		v.Set("year", strconv.Itoa(q.Year))
+	}
+	if q.Season != 0 {
+		v.Set("season_number", strconv.Itoa(q.Season))
+	}
+	if q.Episode != 0 {
+		v.Set("episode_number", strconv.Itoa(q.Episode))
+	}
+	if q.ParentIMDBID != "" {
+		v.Set("parent_imdb_id", q.ParentIMDBID)
+	}
+	if q.TMDBID != "" {
+		v.Set("tmdb_id", q.TMDBID)
+	}
+	return v
+}
+
+// Key returns stable string representation of the query.
+func (q Query) Key() string {
+	return q.Values().Encode()
+}
+
 type SubtitleDownloadRequest struct {
 	FileID    int    `json:"file_id"`
 	SubFormat string `json:"sub_format,omitempty"`
@@ -44,8 +93,15 @@ type SubtitleSearchResponse struct {
 }
 
 type Subtitle struct {
-	Id         string `json:"id"`
-	Type       string `json:"type"`
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	// MatchedBy is set by the service, it tells how the subtitle was found
+	MatchedBy string `json:"-"`
+	// Provider is set by the service, it tells where the subtitle comes from
+	Provider string `json:"-"`
+	// Stale is set by the service, it tells that the subtitle comes from
+	// expired cache served while osdb is down
+	Stale      bool `json:"-"`
 	Attributes struct {
 		SubtitleId        string    `json:"subtitle_id"`
 		Language          string    `json:"language"`
@@ -61,6 +117,7 @@ type Subtitle struct {
 		ForeignPartsOnly  bool      `json:"foreign_parts_only"`
 		AiTranslated      bool      `json:"ai_translated"`
 		MachineTranslated bool      `json:"machine_translated"`
+		MoviehashMatch    bool      `json:"moviehash_match"`
 		UploadDate        time.Time `json:"upload_date"`
 		Release           string    `json:"release"`
 		Comments          string    `json:"comments"`
@@ -85,10 +142,22 @@ type Subtitle struct {
 			Url    string `json:"url"`
 			ImgUrl string `json:"img_url"`
 		} `json:"related_links"`
-		Files []struct {
-			FileId   int    `json:"file_id"`
-			CdNumber int    `json:"cd_number"`
-			FileName string `json:"file_name"`
-		} `json:"files"`
+		Files []SubtitleFile `json:"files"`
 	} `json:"attributes"`
 }
+
+type SubtitleFile struct {
+	FileId   int    `json:"file_id"`
+	CdNumber int    `json:"cd_number"`
+	FileName string `json:"file_name"`
+}
+
+// SortedFiles returns subtitle files ordered by CD number.
+func (s *Subtitle) SortedFiles() []SubtitleFile {
+	files := make([]SubtitleFile, len(s.Attributes.Files))
+	copy(files, s.Attributes.Files)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].CdNumber < files[j].CdNumber
+	})
+	return files
+}
@@ -0,0 +1,90 @@
+package osdb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Quota is download quota reported by the API with every download.
+type Quota struct {
+	Account   string    `json:"account,omitempty"`
+	Requests  int       `json:"requests"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// QuotaError is returned when no downloads remain until ResetAt.
+type QuotaError struct {
+	ResetAt time.Time
+	Message string
+}
+
+func (s *QuotaError) Error() string {
+	return fmt.Sprintf("download quota exceeded until %v: %v", s.ResetAt.Format(time.RFC3339), s.Message)
+}
+
+// RetryAfter returns time left until quota reset.
+func (s *QuotaError) RetryAfter() time.Duration {
+	d := time.Until(s.ResetAt)
+	if d < time.Second {
+		return time.Second
+	}
+	return d
+}
+
+// quotaTracker keeps the last reported quota.
+type quotaTracker struct {
+	quota Quota
+	mux   sync.Mutex
+}
+
+func (s *quotaTracker) get() Quota {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.quota
+}
+
+func (s *quotaTracker) update(r *SubtitleDownloadResponse) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.quota = Quota{
+		Requests:  r.Requests,
+		Remaining: r.Remaining,
+		ResetAt:   r.ResetTimeUtc,
+		Message:   r.Message,
+		UpdatedAt: time.Now(),
+	}
+}
+
+// exhaust marks quota as exhausted, if API reports no reset time downloads
+// are refused for fallback duration.
+func (s *quotaTracker) exhaust(r *SubtitleDownloadResponse, fallback time.Duration) *QuotaError {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	resetAt := r.ResetTimeUtc
+	if resetAt.Before(time.Now()) {
+		resetAt = time.Now().Add(fallback)
+	}
+	s.quota = Quota{
+		Requests:  r.Requests,
+		Remaining: 0,
+		ResetAt:   resetAt,
+		Message:   r.Message,
+		UpdatedAt: time.Now(),
+	}
+	return &QuotaError{ResetAt: resetAt, Message: r.Message}
+}
+
+// check refuses download early while quota is exhausted.
+func (s *quotaTracker) check() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	q := s.quota
+	if q.UpdatedAt.IsZero() || q.Remaining > 0 || time.Now().After(q.ResetAt) {
+		return nil
+	}
+	return &QuotaError{ResetAt: q.ResetAt, Message: q.Message}
+}
@@ -0,0 +1,51 @@
+package osdb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// tokenTTL is used when token expiry can't be read from the token itself.
+	tokenTTL = time.Hour
+	// tokenSkew makes token refresh a bit earlier than it actually expires.
+	tokenSkew = time.Minute
+)
+
+// tokenExpiry reads exp claim of JWT token, fallbacks to tokenTTL from now.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) == 3 {
+		d, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+		if err == nil {
+			var claims struct {
+				Exp int64 `json:"exp"`
+			}
+			if err := json.Unmarshal(d, &claims); err == nil && claims.Exp > 0 {
+				return time.Unix(claims.Exp, 0).Add(-tokenSkew)
+			}
+		}
+	}
+	return time.Now().Add(tokenTTL - tokenSkew)
+}
+
+// baseURL returns api url with host replaced by base url returned on login.
+func baseURL(apiURL string, base string) string {
+	if base == "" {
+		return apiURL
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return apiURL
+	}
+	if b, err := url.Parse(base); err == nil && b.Host != "" {
+		u.Scheme = b.Scheme
+		u.Host = b.Host
+	} else {
+		u.Host = strings.TrimRight(base, "/")
+	}
+	return u.String()
+}
@@ -0,0 +1,285 @@
+package osdb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Minimal XML-RPC codec, only types used by the legacy OpenSubtitles API
+// are supported. Structs are decoded into map[string]interface{}, arrays
+// into []interface{}, base64 into []byte.
+
+func encodeRequest(method string, params ...interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0"?><methodCall><methodName>`)
+	xml.EscapeText(&b, []byte(method))
+	b.WriteString(`</methodName><params>`)
+	for _, p := range params {
+		b.WriteString(`<param>`)
+		if err := encodeValue(&b, p); err != nil {
+			return nil, err
+		}
+		b.WriteString(`</param>`)
+	}
+	b.WriteString(`</params></methodCall>`)
+	return b.Bytes(), nil
+}
+
+func encodeValue(b *bytes.Buffer, v interface{}) error {
+	b.WriteString(`<value>`)
+	switch t := v.(type) {
+	case string:
+		b.WriteString(`<string>`)
+		xml.EscapeText(b, []byte(t))
+		b.WriteString(`</string>`)
+	case int:
+		b.WriteString(`<int>` + strconv.Itoa(t) + `</int>`)
+	case bool:
+		if t {
+			b.WriteString(`<boolean>1</boolean>`)
+		} else {
+			b.WriteString(`<boolean>0</boolean>`)
+		}
+	case float64:
+		b.WriteString(`<double>` + strconv.FormatFloat(t, 'f', -1, 64) + `</double>`)
+	case []byte:
+		b.WriteString(`<base64>` + base64.StdEncoding.EncodeToString(t) + `</base64>`)
+	case []interface{}:
+		b.WriteString(`<array><data>`)
+		for _, e := range t {
+			if err := encodeValue(b, e); err != nil {
+				return err
+			}
+		}
+		b.WriteString(`</data></array>`)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteString(`<struct>`)
+		for _, k := range keys {
+			b.WriteString(`<member><name>`)
+			xml.EscapeText(b, []byte(k))
+			b.WriteString(`</name>`)
+			if err := encodeValue(b, t[k]); err != nil {
+				return err
+			}
+			b.WriteString(`</member>`)
+		}
+		b.WriteString(`</struct>`)
+	default:
+		return errors.Errorf("unsupported xml-rpc type %T", v)
+	}
+	b.WriteString(`</value>`)
+	return nil
+}
+
+type xmlrpcFault struct {
+	Code   int
+	String string
+}
+
+func (s *xmlrpcFault) Error() string {
+	return "xml-rpc fault code=" + strconv.Itoa(s.Code) + " " + s.String
+}
+
+// decodeResponse returns the first param of method response.
+func decodeResponse(r io.Reader) (interface{}, error) {
+	d := xml.NewDecoder(r)
+	fault := false
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find xml-rpc value")
+		}
+		se, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "fault":
+			fault = true
+		case "value":
+			v, err := decodeValue(d)
+			if err != nil {
+				return nil, err
+			}
+			if fault {
+				m, _ := v.(map[string]interface{})
+				code, _ := m["faultCode"].(int)
+				str, _ := m["faultString"].(string)
+				return nil, &xmlrpcFault{Code: code, String: str}
+			}
+			return v, nil
+		}
+	}
+}
+
+// decodeValue decodes value after its start element was consumed.
+func decodeValue(d *xml.Decoder) (interface{}, error) {
+	var text strings.Builder
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode xml-rpc value")
+		}
+		switch tt := t.(type) {
+		case xml.CharData:
+			text.Write(tt)
+		case xml.EndElement:
+			// untyped value is a string
+			return text.String(), nil
+		case xml.StartElement:
+			v, err := decodeTyped(d, tt)
+			if err != nil {
+				return nil, err
+			}
+			if err := d.Skip(); err != nil {
+				return nil, errors.Wrap(err, "failed to decode xml-rpc value")
+			}
+			return v, nil
+		}
+	}
+}
+
+func decodeTyped(d *xml.Decoder, se xml.StartElement) (interface{}, error) {
+	switch se.Name.Local {
+	case "struct":
+		return decodeStruct(d)
+	case "array":
+		return decodeArray(d)
+	}
+	s, err := decodeText(d)
+	if err != nil {
+		return nil, err
+	}
+	s = strings.TrimSpace(s)
+	switch se.Name.Local {
+	case "int", "i4", "i8":
+		return strconv.Atoi(s)
+	case "boolean":
+		return s == "1", nil
+	case "double":
+		return strconv.ParseFloat(s, 64)
+	case "base64":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	case "nil":
+		return nil, nil
+	}
+	return s, nil
+}
+
+func decodeText(d *xml.Decoder) (string, error) {
+	var text strings.Builder
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return "", errors.Wrap(err, "failed to decode xml-rpc text")
+		}
+		switch tt := t.(type) {
+		case xml.CharData:
+			text.Write(tt)
+		case xml.EndElement:
+			return text.String(), nil
+		case xml.StartElement:
+			if err := d.Skip(); err != nil {
+				return "", err
+			}
+		}
+	}
+}
+
+func decodeStruct(d *xml.Decoder) (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode xml-rpc struct")
+		}
+		switch tt := t.(type) {
+		case xml.EndElement:
+			return res, nil
+		case xml.StartElement:
+			if tt.Name.Local != "member" {
+				if err := d.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			name, v, err := decodeMember(d)
+			if err != nil {
+				return nil, err
+			}
+			res[name] = v
+		}
+	}
+}
+
+func decodeMember(d *xml.Decoder) (string, interface{}, error) {
+	var name string
+	var value interface{}
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return "", nil, errors.Wrap(err, "failed to decode xml-rpc member")
+		}
+		switch tt := t.(type) {
+		case xml.EndElement:
+			return name, value, nil
+		case xml.StartElement:
+			switch tt.Name.Local {
+			case "name":
+				name, err = decodeText(d)
+			case "value":
+				value, err = decodeValue(d)
+			default:
+				err = d.Skip()
+			}
+			if err != nil {
+				return "", nil, err
+			}
+		}
+	}
+}
+
+func decodeArray(d *xml.Decoder) ([]interface{}, error) {
+	res := []interface{}{}
+	depth := 0
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode xml-rpc array")
+		}
+		switch tt := t.(type) {
+		case xml.EndElement:
+			if depth == 0 {
+				return res, nil
+			}
+			depth--
+		case xml.StartElement:
+			switch tt.Name.Local {
+			case "data":
+				depth++
+			case "value":
+				v, err := decodeValue(d)
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, v)
+			default:
+				if err := d.Skip(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+}
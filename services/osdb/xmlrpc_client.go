@@ -0,0 +1,442 @@
+package osdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"github.com/webtor-io/video-info/services/retry"
+)
+
+// XMLRPCClient is a client of the legacy OpenSubtitles XML-RPC API. It has
+// its own quota and still finds some hashes unknown to the REST API.
+type XMLRPCClient struct {
+	url     string
+	ua      string
+	user    string
+	pass    string
+	cl      *http.Client
+	token   string
+	used    time.Time
+	mux     sync.Mutex
+	quota   quotaTracker
+	retry   *retry.Policy
+	breaker *Breaker
+}
+
+const (
+	OsdbXMLRPCURLFlag       = "osdb-xmlrpc-url"
+	OsdbXMLRPCUserAgentFlag = "osdb-xmlrpc-user-agent"
+	OsdbXMLRPCUser          = "osdb-xmlrpc-user"
+	OsdbXMLRPCPass          = "osdb-xmlrpc-pass"
+)
+
+const (
+	xmlrpcSearchLimit = 500
+	// legacy API drops sessions idle for about 15 minutes
+	xmlrpcSessionIdle = 10 * time.Minute
+	// legacy API reports neither remaining downloads nor reset time
+	xmlrpcQuotaReset = time.Hour
+)
+
+func RegisterXMLRPCClientFlags(f []cli.Flag) []cli.Flag {
+	return append(f,
+		cli.StringFlag{
+			Name:   OsdbXMLRPCURLFlag,
+			Usage:  "osdb xml-rpc api url",
+			Value:  "https://api.opensubtitles.org/xml-rpc",
+			EnvVar: "OSDB_XMLRPC_URL",
+		},
+		cli.StringFlag{
+			Name:   OsdbXMLRPCUserAgentFlag,
+			Usage:  "osdb xml-rpc registered user agent, xml-rpc api is disabled without it",
+			Value:  "",
+			EnvVar: "OSDB_XMLRPC_USER_AGENT",
+		},
+		cli.StringFlag{
+			Name:   OsdbXMLRPCUser,
+			Usage:  "osdb xml-rpc user (anonymous if empty)",
+			Value:  "",
+			EnvVar: "OSDB_XMLRPC_USER",
+		},
+		cli.StringFlag{
+			Name:   OsdbXMLRPCPass,
+			Usage:  "osdb xml-rpc pass",
+			Value:  "",
+			EnvVar: "OSDB_XMLRPC_PASS",
+		},
+	)
+}
+
+func NewXMLRPCClient(c *cli.Context, cl *http.Client, r *retry.Policy, b *Breaker) *XMLRPCClient {
+	if c.String(OsdbXMLRPCUserAgentFlag) == "" {
+		return nil
+	}
+	return &XMLRPCClient{
+		url:     c.String(OsdbXMLRPCURLFlag),
+		ua:      c.String(OsdbXMLRPCUserAgentFlag),
+		user:    c.String(OsdbXMLRPCUser),
+		pass:    c.String(OsdbXMLRPCPass),
+		cl:      cl,
+		retry:   r,
+		breaker: b,
+	}
+}
+
+type xmlrpcStatusError struct {
+	status string
+}
+
+func (s *xmlrpcStatusError) Error() string {
+	return "got bad xml-rpc status " + s.status
+}
+
+// Temporary tells whether status reports server failure or rate limit.
+func (s *xmlrpcStatusError) Temporary() bool {
+	return strings.HasPrefix(s.status, "5") || strings.HasPrefix(s.status, "429")
+}
+
+// Available tells whether xml-rpc api is not known to be down.
+func (s *XMLRPCClient) Available() bool {
+	return !s.breaker.Down()
+}
+
+// do calls fn through circuit breaker and retry policy.
+func (s *XMLRPCClient) do(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	return s.breaker.Do(ctx, func(ctx context.Context) error {
+		return s.retry.Do(ctx, op, fn)
+	})
+}
+
+func (s *XMLRPCClient) call(ctx context.Context, method string, params ...interface{}) (map[string]interface{}, error) {
+	rb, err := encodeRequest(method, params...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode %v request", method)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(rb))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make new %v request", method)
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	req.Header.Set("User-Agent", s.ua)
+	res, err := s.cl.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to do %v request", method)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		d, _ := io.ReadAll(res.Body)
+		return nil, errors.Wrapf(retry.NewHTTPError(res, d), "got bad status code on %v request", method)
+	}
+	v, err := decodeResponse(res.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %v response", method)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("unexpected %v response %v", method, v)
+	}
+	if st := xmlrpcString(m, "status"); !strings.HasPrefix(st, "200") {
+		return nil, &xmlrpcStatusError{status: st}
+	}
+	return m, nil
+}
+
+func (s *XMLRPCClient) getToken(ctx context.Context) (string, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.token != "" && time.Since(s.used) < xmlrpcSessionIdle {
+		return s.token, nil
+	}
+	m, err := s.call(ctx, "LogIn", s.user, s.pass, "en", s.ua)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to login")
+	}
+	s.token = xmlrpcString(m, "token")
+	s.used = time.Now()
+	return s.token, nil
+}
+
+// isSessionError tells whether status reports missing or expired session.
+func isSessionError(err error) bool {
+	var se *xmlrpcStatusError
+	return errors.As(err, &se) && (strings.HasPrefix(se.status, "401") || strings.HasPrefix(se.status, "406"))
+}
+
+// callWithToken calls method with session token as the first param, session
+// is renewed once if it has expired. Idle session is renewed beforehand.
+func (s *XMLRPCClient) callWithToken(ctx context.Context, method string, params ...interface{}) (map[string]interface{}, error) {
+	for i := 0; ; i++ {
+		token, err := s.getToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		m, err := s.call(ctx, method, append([]interface{}{token}, params...)...)
+		if i == 0 && isSessionError(err) {
+			s.mux.Lock()
+			if s.token == token {
+				s.token = ""
+			}
+			s.mux.Unlock()
+			continue
+		}
+		if err == nil {
+			s.mux.Lock()
+			if s.token == token {
+				s.used = time.Now()
+			}
+			s.mux.Unlock()
+		}
+		return m, err
+	}
+}
+
+func (s *XMLRPCClient) SearchSubtitlesByHash(ctx context.Context, hash string, size int64, languages []string) ([]Subtitle, error) {
+	if len(hash) < 16 {
+		hash = strings.Repeat("0", 16-len(hash)) + hash
+	}
+	return s.search(ctx, map[string]interface{}{
+		"moviehash":     hash,
+		"moviebytesize": strconv.FormatInt(size, 10),
+	}, languages)
+}
+
+func (s *XMLRPCClient) SearchSubtitlesByIMDB(ctx context.Context, id string, languages []string) ([]Subtitle, error) {
+	return s.search(ctx, map[string]interface{}{
+		"imdbid": strings.TrimPrefix(strings.ToLower(id), "tt"),
+	}, languages)
+}
+
+func (s *XMLRPCClient) SearchSubtitlesByQuery(ctx context.Context, q Query, languages []string) ([]Subtitle, error) {
+	c := map[string]interface{}{}
+	if q.Query != "" {
+		c["query"] = q.Query
+	}
+	if q.Season != 0 {
+		c["season"] = strconv.Itoa(q.Season)
+	}
+	if q.Episode != 0 {
+		c["episode"] = strconv.Itoa(q.Episode)
+	}
+	if q.ParentIMDBID != "" {
+		c["imdbid"] = strings.TrimPrefix(strings.ToLower(q.ParentIMDBID), "tt")
+	}
+	if len(c) == 0 {
+		return nil, nil
+	}
+	subs, err := s.search(ctx, c, languages)
+	if err != nil || q.Year == 0 {
+		return subs, err
+	}
+	// legacy API has no year criterion, so results are filtered by movie year
+	var res []Subtitle
+	for _, sub := range subs {
+		if y := sub.Attributes.FeatureDetails.Year; y == 0 || y == q.Year {
+			res = append(res, sub)
+		}
+	}
+	return res, nil
+}
+
+func (s *XMLRPCClient) search(ctx context.Context, criteria map[string]interface{}, languages []string) ([]Subtitle, error) {
+	criteria["sublanguageid"] = legacyLanguageIDs(languages)
+	var m map[string]interface{}
+	err := s.do(ctx, "osdb_xmlrpc_search", func(ctx context.Context) (err error) {
+		m, err = s.callWithToken(ctx, "SearchSubtitles", []interface{}{criteria}, map[string]interface{}{
+			"limit": xmlrpcSearchLimit,
+		})
+		return
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search subtitles")
+	}
+	// data is false when nothing is found
+	rows, _ := m["data"].([]interface{})
+	var res []Subtitle
+	index := map[string]int{}
+	for _, r := range rows {
+		row, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id := xmlrpcString(row, "IDSubtitle")
+		i, ok := index[id]
+		if !ok {
+			i = len(res)
+			index[id] = i
+			res = append(res, makeXMLRPCSubtitle(row))
+		}
+		fileID, _ := strconv.Atoi(xmlrpcString(row, "IDSubtitleFile"))
+		cd, _ := strconv.Atoi(xmlrpcString(row, "SubActualCD"))
+		res[i].Attributes.Files = append(res[i].Attributes.Files, SubtitleFile{
+			FileId:   fileID,
+			CdNumber: cd,
+			FileName: xmlrpcString(row, "SubFileName"),
+		})
+	}
+	return res, nil
+}
+
+func makeXMLRPCSubtitle(row map[string]interface{}) Subtitle {
+	sub := Subtitle{
+		Id:   xmlrpcString(row, "IDSubtitle"),
+		Type: "subtitle",
+	}
+	a := &sub.Attributes
+	a.SubtitleId = sub.Id
+	a.LegacySubtitleId, _ = strconv.Atoi(sub.Id)
+	a.Language = legacyLanguage(xmlrpcString(row, "ISO639"))
+	a.DownloadCount, _ = strconv.Atoi(xmlrpcString(row, "SubDownloadsCnt"))
+	a.Votes, _ = strconv.Atoi(xmlrpcString(row, "SubSumVotes"))
+	a.Ratings, _ = strconv.ParseFloat(xmlrpcString(row, "SubRating"), 64)
+	a.Fps, _ = strconv.ParseFloat(xmlrpcString(row, "MovieFPS"), 64)
+	a.HearingImpaired = xmlrpcString(row, "SubHearingImpaired") == "1"
+	a.FromTrusted = xmlrpcString(row, "SubFromTrusted") == "1"
+	a.ForeignPartsOnly = xmlrpcString(row, "SubForeignPartsOnly") == "1"
+	a.MachineTranslated = xmlrpcString(row, "SubAutoTranslation") == "1"
+	a.MoviehashMatch = xmlrpcString(row, "MatchedBy") == "moviehash"
+	a.Release = xmlrpcString(row, "MovieReleaseName")
+	a.Comments = xmlrpcString(row, "SubAuthorComment")
+	a.UploadDate, _ = time.Parse("2006-01-02 15:04:05", xmlrpcString(row, "SubAddDate"))
+	a.Uploader.Name = xmlrpcString(row, "UserNickName")
+	a.Uploader.Rank = xmlrpcString(row, "UserRank")
+	a.FeatureDetails.Title = xmlrpcString(row, "MovieName")
+	a.FeatureDetails.FeatureType = xmlrpcString(row, "MovieKind")
+	a.FeatureDetails.Year, _ = strconv.Atoi(xmlrpcString(row, "MovieYear"))
+	a.FeatureDetails.ImdbId, _ = strconv.Atoi(xmlrpcString(row, "IDMovieImdb"))
+	return sub
+}
+
+// DownloadSubtitle returns original subtitle file, it is transferred as
+// gzipped base64 data.
+func (s *XMLRPCClient) DownloadSubtitle(ctx context.Context, id int) ([]byte, error) {
+	if err := s.quota.check(); err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	err := s.do(ctx, "osdb_xmlrpc_download", func(ctx context.Context) (err error) {
+		m, err = s.callWithToken(ctx, "DownloadSubtitles", []interface{}{strconv.Itoa(id)})
+		return
+	})
+	var se *xmlrpcStatusError
+	if errors.As(err, &se) && strings.HasPrefix(se.status, "407") {
+		return nil, s.quota.exhaust(&SubtitleDownloadResponse{Message: se.status}, xmlrpcQuotaReset)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to download subtitle")
+	}
+	rows, _ := m["data"].([]interface{})
+	if len(rows) == 0 {
+		return nil, errors.Errorf("no data for subtitle file id=%v", id)
+	}
+	row, _ := rows[0].(map[string]interface{})
+	var data []byte
+	switch v := row["data"].(type) {
+	case []byte:
+		data = v
+	case string:
+		data, err = decodeBase64(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode subtitle data")
+		}
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open gzipped subtitle data")
+	}
+	defer gr.Close()
+	d, err := io.ReadAll(gr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read gzipped subtitle data")
+	}
+	return d, nil
+}
+
+// Quotas returns known download quota, it is reported only when exhausted.
+func (s *XMLRPCClient) Quotas() []Quota {
+	q := s.quota.get()
+	q.Account = accountLabel(0)
+	return []Quota{q}
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+// legacyLanguages maps ISO 639-1 codes to language ids of the legacy API.
+var legacyLanguages = map[string]string{
+	"sq": "alb", "ar": "ara", "hy": "arm", "eu": "baq", "be": "bel", "bn": "ben",
+	"bs": "bos", "bg": "bul", "my": "bur", "ca": "cat", "zh": "chi", "zh-cn": "chi",
+	"zh-tw": "zht", "cs": "cze", "da": "dan", "nl": "dut", "en": "eng", "et": "est",
+	"fa": "per", "fi": "fin", "fr": "fre", "ka": "geo", "de": "ger", "ga": "gle",
+	"gl": "glg", "el": "ell", "he": "heb", "hi": "hin", "hr": "hrv", "hu": "hun",
+	"is": "ice", "id": "ind", "it": "ita", "ja": "jpn", "kk": "kaz", "ko": "kor",
+	"lv": "lav", "lt": "lit", "mk": "mac", "ms": "may", "mn": "mon", "nb": "nor",
+	"no": "nor", "pl": "pol", "pt": "por", "pt-pt": "por", "pt-br": "pob",
+	"ro": "rum", "ru": "rus", "sk": "slo", "sl": "slv", "es": "spa", "sr": "scc",
+	"sv": "swe", "ta": "tam", "te": "tel", "th": "tha", "tr": "tur", "uk": "ukr",
+	"ur": "urd", "vi": "vie", "cy": "wel",
+}
+
+// legacyLanguageIDs makes sublanguageid search parameter, all languages are
+// searched if there is nothing to filter by.
+func legacyLanguageIDs(languages []string) string {
+	var ids []string
+	for _, l := range languages {
+		l = strings.ToLower(l)
+		id, ok := legacyLanguages[l]
+		if !ok {
+			p, _, _ := strings.Cut(l, "-")
+			id, ok = legacyLanguages[p]
+		}
+		if ok && !strings.Contains(","+strings.Join(ids, ",")+",", ","+id+",") {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return "all"
+	}
+	return strings.Join(ids, ",")
+}
+
+// legacyLanguage converts ISO639 field of the legacy API to the language
+// code used by the REST API.
+func legacyLanguage(l string) string {
+	switch l {
+	case "pb":
+		return "pt-br"
+	case "zt":
+		return "zh-tw"
+	}
+	return l
+}
+
+func xmlrpcString(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
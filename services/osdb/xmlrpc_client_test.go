@@ -0,0 +1,171 @@
+package osdb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+var methodNameRe = regexp.MustCompile(`<methodName>([^<]+)</methodName>`)
+
+// xmlrpcServer answers xml-rpc calls with handler results and counts calls
+// of every method.
+type xmlrpcServer struct {
+	*httptest.Server
+	calls map[string]int
+	mux   sync.Mutex
+}
+
+func newXMLRPCServer(t *testing.T, handler func(method string, n int) map[string]interface{}) *xmlrpcServer {
+	s := &xmlrpcServer{calls: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		m := methodNameRe.FindSubmatch(b)
+		if m == nil {
+			t.Errorf("no method name in request %s", b)
+			w.WriteHeader(400)
+			return
+		}
+		method := string(m[1])
+		s.mux.Lock()
+		s.calls[method]++
+		n := s.calls[method]
+		s.mux.Unlock()
+		var v bytes.Buffer
+		if err := encodeValue(&v, handler(method, n)); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+		w.Write([]byte(response(v.String())))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *xmlrpcServer) client() *XMLRPCClient {
+	return &XMLRPCClient{url: s.URL, ua: "test", cl: s.Client()}
+}
+
+func xmlrpcRow(id string, year string) map[string]interface{} {
+	return map[string]interface{}{
+		"IDSubtitle":     id,
+		"IDSubtitleFile": id + "0",
+		"ISO639":         "en",
+		"MovieYear":      year,
+	}
+}
+
+func TestXMLRPCSessionRenewal(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+	}{
+		{name: "no session", status: "406 No session"},
+		{name: "unauthorized", status: "401 Unauthorized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newXMLRPCServer(t, func(method string, n int) map[string]interface{} {
+				if method == "LogIn" {
+					return map[string]interface{}{"status": "200 OK", "token": "token"}
+				}
+				if n == 1 {
+					return map[string]interface{}{"status": tt.status}
+				}
+				return map[string]interface{}{"status": "200 OK", "data": []interface{}{xmlrpcRow("1", "2020")}}
+			})
+			subs, err := srv.client().SearchSubtitlesByIMDB(context.Background(), "tt123", nil)
+			if err != nil {
+				t.Fatalf("SearchSubtitlesByIMDB() error = %v", err)
+			}
+			if len(subs) != 1 || subs[0].Id != "1" {
+				t.Errorf("SearchSubtitlesByIMDB() = %+v", subs)
+			}
+			if srv.calls["LogIn"] != 2 || srv.calls["SearchSubtitles"] != 2 {
+				t.Errorf("calls = %v, want 2 logins and 2 searches", srv.calls)
+			}
+		})
+	}
+}
+
+func TestXMLRPCSessionRenewedOnce(t *testing.T) {
+	srv := newXMLRPCServer(t, func(method string, n int) map[string]interface{} {
+		if method == "LogIn" {
+			return map[string]interface{}{"status": "200 OK", "token": "token"}
+		}
+		return map[string]interface{}{"status": "406 No session"}
+	})
+	if _, err := srv.client().SearchSubtitlesByIMDB(context.Background(), "tt123", nil); err == nil {
+		t.Fatalf("SearchSubtitlesByIMDB() error = nil, want error")
+	}
+	if srv.calls["LogIn"] != 2 || srv.calls["SearchSubtitles"] != 2 {
+		t.Errorf("calls = %v, want 2 logins and 2 searches", srv.calls)
+	}
+}
+
+func TestXMLRPCIdleSession(t *testing.T) {
+	srv := newXMLRPCServer(t, func(method string, n int) map[string]interface{} {
+		if method == "LogIn" {
+			return map[string]interface{}{"status": "200 OK", "token": "token"}
+		}
+		return map[string]interface{}{"status": "200 OK", "data": false}
+	})
+	cl := srv.client()
+	for i := 0; i < 2; i++ {
+		if _, err := cl.SearchSubtitlesByIMDB(context.Background(), "tt123", nil); err != nil {
+			t.Fatalf("SearchSubtitlesByIMDB() error = %v", err)
+		}
+	}
+	if srv.calls["LogIn"] != 1 {
+		t.Errorf("logins = %v, want session reused", srv.calls["LogIn"])
+	}
+	cl.used = time.Now().Add(-xmlrpcSessionIdle)
+	if _, err := cl.SearchSubtitlesByIMDB(context.Background(), "tt123", nil); err != nil {
+		t.Fatalf("SearchSubtitlesByIMDB() error = %v", err)
+	}
+	if srv.calls["LogIn"] != 2 {
+		t.Errorf("logins = %v, want idle session renewed", srv.calls["LogIn"])
+	}
+}
+
+func TestXMLRPCSearchByQueryYear(t *testing.T) {
+	srv := newXMLRPCServer(t, func(method string, n int) map[string]interface{} {
+		if method == "LogIn" {
+			return map[string]interface{}{"status": "200 OK", "token": "token"}
+		}
+		return map[string]interface{}{"status": "200 OK", "data": []interface{}{
+			xmlrpcRow("1", "2020"),
+			xmlrpcRow("2", "1999"),
+			xmlrpcRow("3", ""),
+		}}
+	})
+	tests := []struct {
+		name string
+		year int
+		want []string
+	}{
+		{name: "no year", want: []string{"1", "2", "3"}},
+		{name: "year", year: 2020, want: []string{"1", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subs, err := srv.client().SearchSubtitlesByQuery(context.Background(), Query{Query: "movie", Year: tt.year}, nil)
+			if err != nil {
+				t.Fatalf("SearchSubtitlesByQuery() error = %v", err)
+			}
+			var got []string
+			for _, s := range subs {
+				got = append(got, s.Id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SearchSubtitlesByQuery() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package osdb
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeRequest(t *testing.T) {
+	got, err := encodeRequest("LogIn", "user", "p<a>ss", 1, true, 1.5, []byte("hi"),
+		[]interface{}{"en", 2},
+		map[string]interface{}{"b": false, "a": "x"},
+	)
+	if err != nil {
+		t.Fatalf("encodeRequest() error = %v", err)
+	}
+	want := `<?xml version="1.0"?><methodCall><methodName>LogIn</methodName><params>` +
+		`<param><value><string>user</string></value></param>` +
+		`<param><value><string>p&lt;a&gt;ss</string></value></param>` +
+		`<param><value><int>1</int></value></param>` +
+		`<param><value><boolean>1</boolean></value></param>` +
+		`<param><value><double>1.5</double></value></param>` +
+		`<param><value><base64>aGk=</base64></value></param>` +
+		`<param><value><array><data><value><string>en</string></value><value><int>2</int></value></data></array></value></param>` +
+		`<param><value><struct>` +
+		`<member><name>a</name><value><string>x</string></value></member>` +
+		`<member><name>b</name><value><boolean>0</boolean></value></member>` +
+		`</struct></value></param>` +
+		`</params></methodCall>`
+	if string(got) != want {
+		t.Errorf("encodeRequest() = %s, want %s", got, want)
+	}
+}
+
+func TestEncodeRequestUnsupported(t *testing.T) {
+	if _, err := encodeRequest("m", struct{}{}); err == nil {
+		t.Errorf("encodeRequest() error = nil, want error")
+	}
+}
+
+func response(value string) string {
+	return `<?xml version="1.0"?>
+<methodResponse>
+  <params>
+    <param>
+      ` + value + `
+    </param>
+  </params>
+</methodResponse>`
+}
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want interface{}
+	}{
+		{name: "untyped string", data: response(`<value>plain &amp; text</value>`), want: "plain & text"},
+		{name: "string", data: response(`<value><string> spaced </string></value>`), want: "spaced"},
+		{name: "i4", data: response(`<value><i4>42</i4></value>`), want: 42},
+		{name: "boolean", data: response(`<value><boolean>1</boolean></value>`), want: true},
+		{name: "double", data: response(`<value><double>23.976</double></value>`), want: 23.976},
+		{name: "base64", data: response("<value><base64>aGVs\n bG8=</base64></value>"), want: []byte("hello")},
+		{name: "nil", data: response(`<value><nil/></value>`), want: nil},
+		{name: "empty array", data: response(`<value><array><data></data></array></value>`), want: []interface{}{}},
+		{
+			name: "nested",
+			data: response(`<value><struct>
+				<member><name>status</name><value><string>200 OK</string></value></member>
+				<member><name>data</name><value><array><data>
+					<value><struct>
+						<member><name>IDSubtitleFile</name><value><string>123</string></value></member>
+						<member><name>SubRating</name><value><double>8.5</double></value></member>
+					</struct></value>
+					<value><array><data><value><int>1</int></value></data></array></value>
+				</data></array></value></member>
+				<member><name>seconds</name><value><double>0.1</double></value></member>
+			</struct></value>`),
+			want: map[string]interface{}{
+				"status": "200 OK",
+				"data": []interface{}{
+					map[string]interface{}{"IDSubtitleFile": "123", "SubRating": 8.5},
+					[]interface{}{1},
+				},
+				"seconds": 0.1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeResponse(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("decodeResponse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeResponse() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeResponseFault(t *testing.T) {
+	data := `<?xml version="1.0"?><methodResponse><fault><value><struct>
+		<member><name>faultCode</name><value><int>401</int></value></member>
+		<member><name>faultString</name><value><string>Unauthorized</string></value></member>
+	</struct></value></fault></methodResponse>`
+	_, err := decodeResponse(strings.NewReader(data))
+	var f *xmlrpcFault
+	if !errors.As(err, &f) {
+		t.Fatalf("decodeResponse() error = %v, want fault", err)
+	}
+	if f.Code != 401 || f.String != "Unauthorized" {
+		t.Errorf("decodeResponse() fault = %+v", f)
+	}
+}
+
+func TestDecodeResponseMalformed(t *testing.T) {
+	tests := []string{
+		"",
+		`<methodResponse><params><param></param></params></methodResponse>`,
+		response(`<value><int>x</int></value>`),
+		response(`<value><struct><member><name>a</name>`),
+	}
+	for _, data := range tests {
+		if _, err := decodeResponse(strings.NewReader(data)); err == nil {
+			t.Errorf("decodeResponse(%q) error = nil, want error", data)
+		}
+	}
+}
+
+func TestXMLRPCRoundTrip(t *testing.T) {
+	v := map[string]interface{}{
+		"token": "abc",
+		"list":  []interface{}{"a", 1, false, []byte{0, 1, 2}},
+		"inner": map[string]interface{}{"x": 2.5},
+	}
+	var b bytes.Buffer
+	if err := encodeValue(&b, v); err != nil {
+		t.Fatalf("encodeValue() error = %v", err)
+	}
+	got, err := decodeResponse(strings.NewReader(response(b.String())))
+	if err != nil {
+		t.Fatalf("decodeResponse() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("round trip = %#v, want %#v", got, v)
+	}
+}
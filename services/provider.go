@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"github.com/webtor-io/video-info/services/osdb"
+)
+
+const (
+	ProvidersFlag = "providers"
+)
+
+// Provider is a source of subtitles. All providers share osdb.Subtitle model,
+// subtitle and file ids are unique only within single provider.
+type Provider interface {
+	// Name is used to namespace subtitles in routes, caches and storage.
+	Name() string
+	SearchByHash(ctx context.Context, hash uint64, size int64, languages []string) ([]osdb.Subtitle, error)
+	SearchByIMDB(ctx context.Context, imdbID string, languages []string) ([]osdb.Subtitle, error)
+	SearchByQuery(ctx context.Context, q osdb.Query, languages []string) ([]osdb.Subtitle, error)
+	// Download returns original file of the subtitle.
+	Download(ctx context.Context, sub *osdb.Subtitle, fileID int) ([]byte, error)
+}
+
+// VolatileProvider is implemented by providers which are cheap to query and
+// whose data may change at any time (e.g. local files). Their search results
+// and files are never cached in Redis or S3.
+type VolatileProvider interface {
+	Volatile() bool
+}
+
+func isVolatile(p Provider) bool {
+	v, ok := p.(VolatileProvider)
+	return ok && v.Volatile()
+}
+
+// AvailabilityReporter is implemented by providers which know that their
+// upstream is down, cached results are served instead of waiting on it.
+type AvailabilityReporter interface {
+	Available() bool
+}
+
+func isAvailable(p Provider) bool {
+	a, ok := p.(AvailabilityReporter)
+	return !ok || a.Available()
+}
+
+// QuotaReporter is implemented by providers with limited downloads,
+// it reports quota of every account used by the provider.
+type QuotaReporter interface {
+	Quotas() []osdb.Quota
+}
+
+// Providers holds enabled providers in order of priority.
+type Providers struct {
+	list []Provider
+}
+
+func RegisterProvidersFlags(f []cli.Flag) []cli.Flag {
+	return append(f,
+		cli.StringFlag{
+			Name:   ProvidersFlag,
+			Usage:  "comma separated subtitle providers in order of priority (local, opensubtitles, opensubtitles-xmlrpc)",
+			Value:  OpenSubtitlesProviderName,
+			EnvVar: "PROVIDERS",
+		},
+	)
+}
+
+// NewProviders picks providers enabled with flag out of all available ones.
+// nil providers are treated as not configured.
+func NewProviders(c *cli.Context, ps ...Provider) (*Providers, error) {
+	available := map[string]Provider{}
+	for _, p := range ps {
+		if p != nil {
+			available[p.Name()] = p
+		}
+	}
+	res := &Providers{}
+	for _, name := range strings.Split(c.String(ProvidersFlag), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		p, ok := available[name]
+		if !ok {
+			return nil, errors.Errorf("provider %v is unknown or not configured", name)
+		}
+		if res.Get(name) == nil {
+			res.list = append(res.list, p)
+		}
+	}
+	if len(res.list) == 0 {
+		return nil, errors.New("no providers enabled")
+	}
+	return res, nil
+}
+
+func (s *Providers) List() []Provider {
+	return s.list
+}
+
+func (s *Providers) Get(name string) Provider {
+	for _, p := range s.list {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func isCircuitOpen(err error) bool {
+	var ce *osdb.CircuitOpenError
+	return errors.As(err, &ce)
+}
+
+// markStale flags subtitles served from expired cache.
+func markStale(subs []osdb.Subtitle) []osdb.Subtitle {
+	res := make([]osdb.Subtitle, len(subs))
+	for i, s := range subs {
+		s.Stale = true
+		res[i] = s
+	}
+	return res
+}
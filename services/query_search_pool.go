@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/webtor-io/video-info/services/osdb"
+	"github.com/webtor-io/video-info/services/redis"
+	"github.com/webtor-io/video-info/services/release"
+	"github.com/webtor-io/video-info/services/s3"
+)
+
+type QuerySearchPool struct {
+	searchPool
+}
+
+func NewQuerySearchPool(st *s3.S3Storage) *QuerySearchPool {
+	return &QuerySearchPool{searchPool{s3: st}}
+}
+
+func (s *QuerySearchPool) Get(ctx context.Context, p Provider, query osdb.Query, languages []string, c *redis.Cache, purge bool) ([]osdb.Subtitle, error) {
+	if query.ParentIMDBID != "" {
+		query.ParentIMDBID = normalizeIMDBID(query.ParentIMDBID)
+	}
+	return s.get(ctx, p, query.Key(), languages, c, purge, func(ctx context.Context, _ bool) ([]osdb.Subtitle, error) {
+		subtitles, err := p.SearchByQuery(ctx, query, languages)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get subtitles")
+		}
+		return subtitles, nil
+	})
+}
+
+// makeReleaseQuery makes search query from release info guessed from the
+// path of the video.
+func makeReleaseQuery(i *release.Info) osdb.Query {
+	return osdb.Query{
+		Query:   i.Title,
+		Year:    i.Year,
+		Season:  i.Season,
+		Episode: i.Episode,
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+	"github.com/webtor-io/video-info/services/osdb"
+	"github.com/webtor-io/video-info/services/release"
+)
+
+const (
+	RankerTopNFlag = "rank-top-n"
+)
+
+// Ranker scores subtitles, collapses duplicates and keeps only the best
+// ones for each language.
+type Ranker struct {
+	topN int
+}
+
+func RegisterRankerFlags(f []cli.Flag) []cli.Flag {
+	return append(f,
+		cli.IntFlag{
+			Name:   RankerTopNFlag,
+			Usage:  "max number of subtitles per language (0 - unlimited)",
+			Value:  5,
+			EnvVar: "RANK_TOP_N",
+		},
+	)
+}
+
+func NewRanker(c *cli.Context) *Ranker {
+	return &Ranker{
+		topN: c.Int(RankerTopNFlag),
+	}
+}
+
+var ignoredTokens = map[string]bool{
+	"mkv": true, "mp4": true, "avi": true, "m4v": true, "webm": true, "srt": true,
+}
+
+func tokenize(s string) []string {
+	var res []string
+	for _, t := range release.Tokens(s) {
+		if !ignoredTokens[t] {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// releaseSimilarity compares subtitle release name with the release of the
+// video. Returns value between 0 and 1.
+func releaseSimilarity(rel string, path string, pi *release.Info) float64 {
+	rt := tokenize(rel)
+	if len(rt) == 0 || path == "" {
+		return 0
+	}
+	pt := map[string]bool{}
+	for _, t := range tokenize(path) {
+		pt[t] = true
+	}
+	n := 0
+	for _, t := range rt {
+		if pt[t] {
+			n++
+		}
+	}
+	tokens := float64(n) / float64(len(rt))
+
+	ri := release.Parse(rel)
+	fields, matched := 0, 0
+	match := func(a, b string) {
+		if a == "" || b == "" {
+			return
+		}
+		fields++
+		if strings.EqualFold(a, b) {
+			matched++
+		}
+	}
+	match(ri.Group, pi.Group)
+	match(ri.Source, pi.Source)
+	match(ri.Resolution, pi.Resolution)
+	match(ri.Codec, pi.Codec)
+	if ri.Episode != 0 && pi.Episode != 0 {
+		fields++
+		if ri.Season == pi.Season && ri.Episode == pi.Episode {
+			matched++
+		}
+	}
+	if fields == 0 {
+		return tokens
+	}
+	return (tokens + float64(matched)/float64(fields)) / 2
+}
+
+func (s *Ranker) score(sub *osdb.Subtitle, path string, pi *release.Info) float64 {
+	a := &sub.Attributes
+	score := 0.0
+	if a.MoviehashMatch {
+		score += 100
+	}
+	if a.FromTrusted {
+		score += 20
+	}
+	score += a.Ratings * 3
+	score += math.Log10(1+float64(a.DownloadCount)) * 5
+	score += math.Log10(1+float64(a.Votes)) * 2
+	score += releaseSimilarity(a.Release, path, pi) * 40
+	return score
+}
+
+// dedupKey groups subtitles made for the same release in the same language.
+// Subtitles without release name are never collapsed.
+func dedupKey(sub *osdb.Subtitle) string {
+	a := &sub.Attributes
+	release := strings.Join(tokenize(a.Release), ".")
+	if release == "" {
+		release = "id:" + sub.Provider + "/" + sub.Id
+	}
+	return strings.Join([]string{
+		strings.ToLower(a.Language),
+		release,
+		boolKey(a.HearingImpaired),
+		boolKey(a.ForeignPartsOnly),
+		strconv.Itoa(len(a.Files)),
+	}, "|")
+}
+
+func boolKey(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// Rank orders subtitles by score, drops duplicates and keeps top-N
+// subtitles per language. path is the release path of the video, it is
+// used to prefer subtitles made for the same release.
+func (s *Ranker) Rank(subs []osdb.Subtitle, path string) []osdb.Subtitle {
+	type scored struct {
+		sub   osdb.Subtitle
+		score float64
+	}
+	pi := release.Parse(path)
+	ss := make([]scored, len(subs))
+	for i := range subs {
+		ss[i] = scored{sub: subs[i], score: s.score(&subs[i], path, pi)}
+	}
+	sort.SliceStable(ss, func(i, j int) bool {
+		return ss[i].score > ss[j].score
+	})
+	seen := map[string]bool{}
+	perLang := map[string]int{}
+	res := []osdb.Subtitle{}
+	for _, v := range ss {
+		k := dedupKey(&v.sub)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		lang := strings.ToLower(v.sub.Attributes.Language)
+		if s.topN > 0 && perLang[lang] >= s.topN {
+			continue
+		}
+		perLang[lang]++
+		res = append(res, v.sub)
+	}
+	return res
+}
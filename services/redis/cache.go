@@ -5,17 +5,114 @@ import (
 	"context"
 	"encoding/gob"
 	"github.com/redis/go-redis/v9"
+	"github.com/webtor-io/video-info/services/media"
 	"github.com/webtor-io/video-info/services/osdb"
 	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/urfave/cli"
 	cs "github.com/webtor-io/common-services"
 )
 
+const (
+	CacheSoftTTLFlag  = "cache-soft-ttl"
+	CacheHardTTLFlag  = "cache-hard-ttl"
+	CacheStaleTTLFlag = "cache-stale-ttl"
+	CacheEmptyTTLFlag = "cache-empty-ttl"
+)
+
+func RegisterCacheFlags(f []cli.Flag) []cli.Flag {
+	return append(f,
+		cli.DurationFlag{
+			Name:   CacheSoftTTLFlag,
+			Usage:  "age of search results after which they are served and refreshed in background",
+			Value:  time.Hour * 6,
+			EnvVar: "CACHE_SOFT_TTL",
+		},
+		cli.DurationFlag{
+			Name:   CacheHardTTLFlag,
+			Usage:  "age of search results after which they are searched again before serving",
+			Value:  time.Hour * 24,
+			EnvVar: "CACHE_HARD_TTL",
+		},
+		cli.DurationFlag{
+			Name:   CacheStaleTTLFlag,
+			Usage:  "time search results are kept after hard ttl to be served while osdb is down",
+			Value:  time.Hour * 24 * 7,
+			EnvVar: "CACHE_STALE_TTL",
+		},
+		cli.DurationFlag{
+			Name:   CacheEmptyTTLFlag,
+			Usage:  "time empty search results are cached, 0 disables caching of them",
+			Value:  time.Hour,
+			EnvVar: "CACHE_EMPTY_TTL",
+		},
+	)
+}
+
+// TTL holds lifetimes of cached search results.
+type TTL struct {
+	Soft  time.Duration
+	Hard  time.Duration
+	Stale time.Duration
+	Empty time.Duration
+}
+
+// Freshness tells how cached search result may be used.
+type Freshness int
+
+const (
+	// Missing means nothing is cached
+	Missing Freshness = iota
+	// Fresh result is served as is, it may be empty
+	Fresh
+	// SoftExpired result is served and refreshed in background
+	SoftExpired
+	// HardExpired result is served only while osdb is down
+	HardExpired
+)
+
+// freshness tells how cached search result may be used at the moment.
+func (s *TTL) freshness(e *subtitlesEntry, now time.Time) Freshness {
+	// empty result lives in redis for its own ttl only
+	if len(e.Subtitles) == 0 {
+		return Fresh
+	}
+	age := now.Sub(e.StoredAt)
+	switch {
+	case age > s.Hard:
+		return HardExpired
+	case age > s.Soft:
+		return SoftExpired
+	}
+	return Fresh
+}
+
+// expiration returns time search result is cached for, zero means it should
+// not be cached at all. keep is true when previous result should stay as is.
+func (s *TTL) expiration(subs []osdb.Subtitle, prev []osdb.Subtitle, prevFreshness Freshness) (ttl time.Duration, keep bool) {
+	if len(subs) > 0 {
+		return s.Hard + s.Stale, false
+	}
+	// empty refresh result is likely a glitch, so not yet hard expired
+	// subtitles are kept
+	if len(prev) > 0 && (prevFreshness == Fresh || prevFreshness == SoftExpired) {
+		return 0, true
+	}
+	if s.Empty <= 0 {
+		return 0, false
+	}
+	return s.Empty, false
+}
+
+// mediaInfoFailureTTL is time failed media probe is remembered
+const mediaInfoFailureTTL = 10 * time.Minute
+
 type Cache struct {
 	key string
 	cl  *cs.RedisClient
+	ttl *TTL
 }
 
 type HashAndSize struct {
@@ -23,8 +120,19 @@ type HashAndSize struct {
 	Size int64
 }
 
-func NewCache(key string, cl *cs.RedisClient) *Cache {
-	return &Cache{key: key, cl: cl}
+// subtitlesEntry is cached search result with its store time
+type subtitlesEntry struct {
+	Subtitles []osdb.Subtitle
+	StoredAt  time.Time
+}
+
+func NewCache(key string, cl *cs.RedisClient, ttl *TTL) *Cache {
+	return &Cache{key: key, cl: cl, ttl: ttl}
+}
+
+// Key returns key all cached data is stored with.
+func (s *Cache) Key() string {
+	return s.key
 }
 
 func (s *Cache) GetHashAndSize(ctx context.Context) (uint64, int64, error) {
@@ -66,7 +174,9 @@ func (s *Cache) SetHashAndSize(ctx context.Context, hash uint64, size int64) err
 	return nil
 }
 
-func (s *Cache) GetSubtitles(ctx context.Context) ([]osdb.Subtitle, error) {
+// GetSubtitles returns cached search result with its freshness. Cached empty
+// result is Fresh with no subtitles, Missing means nothing is cached.
+func (s *Cache) GetSubtitles(ctx context.Context) (subs []osdb.Subtitle, freshness Freshness, err error) {
 	//return nil, nil
 	cl := s.cl.Get()
 	//if err != nil {
@@ -74,18 +184,18 @@ func (s *Cache) GetSubtitles(ctx context.Context) ([]osdb.Subtitle, error) {
 	//}
 	data, err := cl.Get(ctx, s.key+"subsrest").Bytes()
 	if errors.Is(err, redis.Nil) {
-		return nil, nil
+		return nil, Missing, nil
 	}
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get subs")
+		return nil, Missing, errors.Wrap(err, "failed to get subs")
 	}
-	var res []osdb.Subtitle
+	var res subtitlesEntry
 	err = s.decode(data, &res)
 	if err != nil {
-		return nil, nil
+		return nil, Missing, nil
 		//return nil, errors.Wrap(err, "failed to decode data")
 	}
-	return res, nil
+	return res.Subtitles, s.ttl.freshness(&res, time.Now()), nil
 }
 
 func (s *Cache) SetSubtitles(ctx context.Context, subs []osdb.Subtitle) error {
@@ -93,23 +203,42 @@ func (s *Cache) SetSubtitles(ctx context.Context, subs []osdb.Subtitle) error {
 	// if err != nil {
 	// 	return errors.Wrap(err, "Failed to get redis client")
 	// }
-	data, err := s.encode(subs)
+	data, err := s.encode(subtitlesEntry{Subtitles: subs, StoredAt: time.Now()})
 	if err != nil {
 		return errors.Wrap(err, "failed to encode subs")
 	}
-	err = cl.Set(ctx, s.key+"subsrest", data, time.Hour*24).Err()
+	var prev []osdb.Subtitle
+	var freshness Freshness
+	if len(subs) == 0 {
+		prev, freshness, err = s.GetSubtitles(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to get previous subs")
+		}
+	}
+	ttl, keep := s.ttl.expiration(subs, prev, freshness)
+	if keep {
+		return nil
+	}
+	if ttl <= 0 {
+		err = cl.Del(ctx, s.key+"subsrest").Err()
+		if err != nil {
+			return errors.Wrap(err, "failed to delete subs")
+		}
+		return nil
+	}
+	err = cl.Set(ctx, s.key+"subsrest", data, ttl).Err()
 	if err != nil {
 		return errors.Wrap(err, "failed to set subs")
 	}
 	return nil
 }
 
-func (s *Cache) GetSubtitle(ctx context.Context, id int, format string) ([]byte, error) {
+func (s *Cache) GetSubtitle(ctx context.Context, provider string, id int, format string) ([]byte, error) {
 	cl := s.cl.Get()
 	// if err != nil {
 	// 	return nil, errors.Wrap(err, "failed to get redis client")
 	// }
-	data, err := cl.Get(ctx, s.key+"sub"+strconv.Itoa(id)+format).Bytes()
+	data, err := cl.Get(ctx, s.key+"sub"+provider+strconv.Itoa(id)+format).Bytes()
 	if errors.Is(err, redis.Nil) {
 		return nil, nil
 	}
@@ -119,18 +248,121 @@ func (s *Cache) GetSubtitle(ctx context.Context, id int, format string) ([]byte,
 	return data, nil
 }
 
-func (s *Cache) SetSubtitle(ctx context.Context, id int, format string, data []byte) error {
+func (s *Cache) SetSubtitle(ctx context.Context, provider string, id int, format string, data []byte) error {
 	cl := s.cl.Get()
 	// if err != nil {
 	// 	return errors.Wrap(err, "failed to get redis client")
 	// }
-	err := cl.Set(ctx, s.key+"sub"+strconv.Itoa(id)+format, data, time.Hour*24).Err()
+	err := cl.Set(ctx, s.key+"sub"+provider+strconv.Itoa(id)+format, data, time.Hour*24).Err()
 	if err != nil {
 		return errors.Wrap(err, "failed to set subtitle")
 	}
 	return nil
 }
 
+func (s *Cache) GetEmbeddedSubtitle(ctx context.Context, track int, format string) ([]byte, error) {
+	if s.key == "" {
+		return nil, nil
+	}
+	cl := s.cl.Get()
+	data, err := cl.Get(ctx, s.key+"embeddedsub"+strconv.Itoa(track)+format).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get embedded subtitle")
+	}
+	return data, nil
+}
+
+func (s *Cache) SetEmbeddedSubtitle(ctx context.Context, track int, format string, data []byte) error {
+	if s.key == "" {
+		return nil
+	}
+	cl := s.cl.Get()
+	err := cl.Set(ctx, s.key+"embeddedsub"+strconv.Itoa(track)+format, data, time.Hour*24).Err()
+	if err != nil {
+		return errors.Wrap(err, "failed to set embedded subtitle")
+	}
+	return nil
+}
+
+func (s *Cache) GetSubtitleCharset(ctx context.Context, provider string, id int) (string, error) {
+	cl := s.cl.Get()
+	data, err := cl.Get(ctx, s.key+"subcharset"+provider+strconv.Itoa(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get subtitle charset")
+	}
+	return data, nil
+}
+
+func (s *Cache) SetSubtitleCharset(ctx context.Context, provider string, id int, charset string) error {
+	cl := s.cl.Get()
+	err := cl.Set(ctx, s.key+"subcharset"+provider+strconv.Itoa(id), charset, time.Hour*24).Err()
+	if err != nil {
+		return errors.Wrap(err, "failed to set subtitle charset")
+	}
+	return nil
+}
+
+func (s *Cache) GetMediaInfo(ctx context.Context) (*media.Info, error) {
+	// media info without source key would be shared by all sources
+	if s.key == "" {
+		return nil, nil
+	}
+	cl := s.cl.Get()
+	data, err := cl.Get(ctx, s.key+"mediainfo").Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get media info")
+	}
+	res := &media.Info{}
+	err = s.decode(data, res)
+	if err != nil {
+		return nil, nil
+	}
+	return res, nil
+}
+
+func (s *Cache) SetMediaInfo(ctx context.Context, info *media.Info) error {
+	if s.key == "" {
+		return nil
+	}
+	cl := s.cl.Get()
+	data, err := s.encode(info)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode media info")
+	}
+	err = cl.Set(ctx, s.key+"mediainfo", data, time.Hour*24).Err()
+	if err != nil {
+		return errors.Wrap(err, "failed to set media info")
+	}
+	return nil
+}
+
+// SetMediaInfoFailure stores empty media info for a short time, so sources
+// which failed to probe are not probed again on every request.
+func (s *Cache) SetMediaInfoFailure(ctx context.Context) error {
+	if s.key == "" {
+		return nil
+	}
+	cl := s.cl.Get()
+	data, err := s.encode(&media.Info{})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode media info")
+	}
+	err = cl.Set(ctx, s.key+"mediainfo", data, mediaInfoFailureTTL).Err()
+	if err != nil {
+		return errors.Wrap(err, "failed to set media info failure")
+	}
+	return nil
+}
+
 func (s *Cache) encode(data interface{}) ([]byte, error) {
 	buf := bytes.NewBuffer(nil)
 	enc := gob.NewEncoder(buf)
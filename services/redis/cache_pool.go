@@ -3,20 +3,30 @@ package redis
 import (
 	"sync"
 
+	"github.com/urfave/cli"
 	cs "github.com/webtor-io/common-services"
 )
 
 type CachePool struct {
-	sm sync.Map
-	cl *cs.RedisClient
+	sm  sync.Map
+	cl  *cs.RedisClient
+	ttl *TTL
 }
 
-func NewCachePool(cl *cs.RedisClient) *CachePool {
-	return &CachePool{cl: cl}
+func NewCachePool(c *cli.Context, cl *cs.RedisClient) *CachePool {
+	return &CachePool{
+		cl: cl,
+		ttl: &TTL{
+			Soft:  c.Duration(CacheSoftTTLFlag),
+			Hard:  c.Duration(CacheHardTTLFlag),
+			Stale: c.Duration(CacheStaleTTLFlag),
+			Empty: c.Duration(CacheEmptyTTLFlag),
+		},
+	}
 }
 
 func (s *CachePool) Get(key string) *Cache {
-	v, loaded := s.sm.LoadOrStore(key, NewCache(key, s.cl))
+	v, loaded := s.sm.LoadOrStore(key, NewCache(key, s.cl, s.ttl))
 	if !loaded {
 		defer s.sm.Delete(key)
 	}
@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/webtor-io/video-info/services/osdb"
+)
+
+var testTTL = &TTL{
+	Soft:  time.Hour,
+	Hard:  3 * time.Hour,
+	Stale: 24 * time.Hour,
+	Empty: 10 * time.Minute,
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Now()
+	subs := []osdb.Subtitle{{Id: "1"}}
+	tests := []struct {
+		name string
+		e    subtitlesEntry
+		want Freshness
+	}{
+		{name: "just stored", e: subtitlesEntry{Subtitles: subs, StoredAt: now}, want: Fresh},
+		{name: "before soft ttl", e: subtitlesEntry{Subtitles: subs, StoredAt: now.Add(-59 * time.Minute)}, want: Fresh},
+		{name: "after soft ttl", e: subtitlesEntry{Subtitles: subs, StoredAt: now.Add(-61 * time.Minute)}, want: SoftExpired},
+		{name: "after hard ttl", e: subtitlesEntry{Subtitles: subs, StoredAt: now.Add(-4 * time.Hour)}, want: HardExpired},
+		{name: "old empty", e: subtitlesEntry{StoredAt: now.Add(-4 * time.Hour)}, want: Fresh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testTTL.freshness(&tt.e, now); got != tt.want {
+				t.Errorf("freshness() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	subs := []osdb.Subtitle{{Id: "1"}}
+	noEmpty := *testTTL
+	noEmpty.Empty = 0
+	tests := []struct {
+		name          string
+		ttl           *TTL
+		subs          []osdb.Subtitle
+		prev          []osdb.Subtitle
+		prevFreshness Freshness
+		wantTTL       time.Duration
+		wantKeep      bool
+	}{
+		{name: "found", ttl: testTTL, subs: subs, wantTTL: 27 * time.Hour},
+		{name: "found over fresh", ttl: testTTL, subs: subs, prev: subs, prevFreshness: Fresh, wantTTL: 27 * time.Hour},
+		{name: "empty", ttl: testTTL, prevFreshness: Missing, wantTTL: 10 * time.Minute},
+		{name: "empty over fresh", ttl: testTTL, prev: subs, prevFreshness: Fresh, wantKeep: true},
+		{name: "empty over soft expired", ttl: testTTL, prev: subs, prevFreshness: SoftExpired, wantKeep: true},
+		{name: "empty over hard expired", ttl: testTTL, prev: subs, prevFreshness: HardExpired, wantTTL: 10 * time.Minute},
+		{name: "empty over empty", ttl: testTTL, prevFreshness: Fresh, wantTTL: 10 * time.Minute},
+		{name: "empty not cached", ttl: &noEmpty, prevFreshness: Missing, wantTTL: 0},
+		{name: "empty not cached over hard expired", ttl: &noEmpty, prev: subs, prevFreshness: HardExpired, wantTTL: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ttl, keep := tt.ttl.expiration(tt.subs, tt.prev, tt.prevFreshness)
+			if ttl != tt.wantTTL || keep != tt.wantKeep {
+				t.Errorf("expiration() = %v, %v, want %v, %v", ttl, keep, tt.wantTTL, tt.wantKeep)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	refreshTimeout = 5 * time.Minute
+)
+
+// refresher runs background refreshes of cached data, only one refresh of
+// the same key runs at a time.
+type refresher struct {
+	sm sync.Map
+}
+
+func (s *refresher) run(key string, fn func(ctx context.Context) error) {
+	if _, loaded := s.sm.LoadOrStore(key, true); loaded {
+		return
+	}
+	go func() {
+		defer s.sm.Delete(key)
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		logger := log.WithField("key", key)
+		logger.Info("refreshing cached subtitles")
+		if err := fn(ctx); err != nil {
+			logger.WithError(err).Warn("failed to refresh cached subtitles")
+		}
+	}()
+}
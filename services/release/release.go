@@ -0,0 +1,226 @@
+package release
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Info holds data guessed from release name
+type Info struct {
+	Title      string
+	Year       int
+	Season     int
+	Episode    int
+	Resolution string
+	Source     string
+	Codec      string
+	Group      string
+}
+
+var (
+	seasonEpisodeRe = regexp.MustCompile(`(?i)\bs(\d{1,2})[ ._-]?e(\d{1,3})\b`)
+	crossEpisodeRe  = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})\b`)
+	seasonRe        = regexp.MustCompile(`(?i)\b(?:s|season[ ._-]?)(\d{1,2})\b`)
+	yearRe          = regexp.MustCompile(`\b(19\d{2}|20\d{2})\b`)
+	resolutionRe    = regexp.MustCompile(`(?i)\b(2160p|1080[pi]|720p|576[pi]|480[pi]|4k|uhd)\b`)
+	sourceRe        = regexp.MustCompile(`(?i)\b(web[ .-]?dl|web[ .-]?rip|webrip|web|blu[ .-]?ray|bdrip|brrip|bdremux|remux|hdtv|pdtv|dvdrip|dvd|hdrip|camrip|cam|telesync|hdcam)\b`)
+	telesyncRe      = regexp.MustCompile(`(?i)(?:^| )(ts)(?:$| |-)`)
+	codecRe         = regexp.MustCompile(`(?i)\b(x264|x265|h[ .]?264|h[ .]?265|hevc|avc|xvid|divx|av1|vp9)\b`)
+	groupRe         = regexp.MustCompile(`-([A-Za-z0-9]+)(?:\[[^\]]*\])?$`)
+	bracketsRe      = regexp.MustCompile(`[\[(][^\])]*[\])]`)
+	separatorRe     = regexp.MustCompile(`[._]+`)
+	spaceRe         = regexp.MustCompile(`\s+`)
+	tokenRe         = regexp.MustCompile(`[\pL\pN]+`)
+	extRe           = regexp.MustCompile(`(?i)\.(mkv|mp4|avi|m4v|webm|mov|wmv|ts|m2ts|srt|ass|ssa|vtt|sub)$`)
+)
+
+var sources = map[string]string{
+	"webdl":    "WEB-DL",
+	"webrip":   "WEBRip",
+	"web":      "WEB",
+	"bluray":   "BluRay",
+	"bdrip":    "BDRip",
+	"brrip":    "BRRip",
+	"bdremux":  "BDRemux",
+	"remux":    "Remux",
+	"hdtv":     "HDTV",
+	"pdtv":     "PDTV",
+	"dvdrip":   "DVDRip",
+	"dvd":      "DVD",
+	"hdrip":    "HDRip",
+	"camrip":   "CAM",
+	"cam":      "CAM",
+	"hdcam":    "CAM",
+	"ts":       "TS",
+	"telesync": "TS",
+}
+
+var codecs = map[string]string{
+	"x264": "H.264",
+	"h264": "H.264",
+	"avc":  "H.264",
+	"x265": "H.265",
+	"h265": "H.265",
+	"hevc": "H.265",
+	"xvid": "XviD",
+	"divx": "DivX",
+	"av1":  "AV1",
+	"vp9":  "VP9",
+}
+
+// Parse guesses release info from file path. Every path element is parsed
+// starting from the file name, missing data is taken from parent
+// directories (e.g. season packs).
+func Parse(p string) *Info {
+	p = strings.Trim(strings.ReplaceAll(p, "\\", "/"), "/")
+	res := &Info{}
+	if p == "" {
+		return res
+	}
+	els := strings.Split(p, "/")
+	var infos []*Info
+	for i := len(els) - 1; i >= 0; i-- {
+		infos = append(infos, parseName(els[i]))
+	}
+	// plain file names like "file.mkv" carry no title, so the title is taken
+	// from the nearest element with recognized release tokens
+	for _, i := range infos {
+		if i.hasTokens() {
+			res.Title = i.Title
+			break
+		}
+	}
+	for _, i := range infos {
+		res.merge(i)
+	}
+	return res
+}
+
+func (s *Info) hasTokens() bool {
+	return s.Year != 0 || s.Season != 0 || s.Resolution != "" || s.Source != "" || s.Codec != "" || s.Group != ""
+}
+
+func (s *Info) merge(i *Info) {
+	if s.Title == "" {
+		s.Title = i.Title
+	}
+	if s.Year == 0 {
+		s.Year = i.Year
+	}
+	if s.Season == 0 {
+		s.Season = i.Season
+	}
+	if s.Episode == 0 {
+		s.Episode = i.Episode
+	}
+	if s.Resolution == "" {
+		s.Resolution = i.Resolution
+	}
+	if s.Source == "" {
+		s.Source = i.Source
+	}
+	if s.Codec == "" {
+		s.Codec = i.Codec
+	}
+	if s.Group == "" {
+		s.Group = i.Group
+	}
+}
+
+func parseName(name string) *Info {
+	res := &Info{}
+	name = extRe.ReplaceAllString(strings.TrimSpace(name), "")
+	name = separatorRe.ReplaceAllString(name, " ")
+	// title ends right before the first recognized token, group follows
+	// the last one
+	end := len(name)
+	last := -1
+	cut := func(loc []int) {
+		if loc == nil {
+			return
+		}
+		if loc[0] < end {
+			end = loc[0]
+		}
+		if loc[1] > last {
+			last = loc[1]
+		}
+	}
+	if m := seasonEpisodeRe.FindStringSubmatchIndex(name); m != nil {
+		res.Season = atoi(name[m[2]:m[3]])
+		res.Episode = atoi(name[m[4]:m[5]])
+		cut(m)
+	} else if m := crossEpisodeRe.FindStringSubmatchIndex(name); m != nil {
+		res.Season = atoi(name[m[2]:m[3]])
+		res.Episode = atoi(name[m[4]:m[5]])
+		cut(m)
+	} else if m := seasonRe.FindStringSubmatchIndex(name); m != nil {
+		res.Season = atoi(name[m[2]:m[3]])
+		cut(m)
+	}
+	// the last year-like number is the year, earlier ones may be a part of the title
+	if ms := yearRe.FindAllStringIndex(name, -1); ms != nil {
+		m := ms[len(ms)-1]
+		if m[0] > 0 {
+			res.Year = atoi(name[m[0]:m[1]])
+			cut(m)
+		}
+	}
+	if m := resolutionRe.FindStringIndex(name); m != nil {
+		res.Resolution = strings.ToLower(name[m[0]:m[1]])
+		if res.Resolution == "4k" || res.Resolution == "uhd" {
+			res.Resolution = "2160p"
+		}
+		cut(m)
+	}
+	if m := sourceRe.FindStringIndex(name); m != nil {
+		res.Source = sources[normalize(name[m[0]:m[1]])]
+		cut(m)
+	} else if res.Year != 0 {
+		// "ts" is a common word, so it is trusted only after the year
+		if m := telesyncRe.FindStringSubmatchIndex(name[last:]); m != nil {
+			res.Source = sources["ts"]
+			cut([]int{last + m[2], last + m[3]})
+		}
+	}
+	if m := codecRe.FindStringIndex(name); m != nil {
+		res.Codec = codecs[normalize(name[m[0]:m[1]])]
+		cut(m)
+	}
+	if last >= 0 {
+		if m := groupRe.FindStringSubmatch(name[last:]); m != nil && !isTag(m[1]) {
+			res.Group = m[1]
+		}
+	}
+	if m := bracketsRe.FindStringIndex(name); m != nil {
+		cut(m)
+	}
+	res.Title = strings.Trim(spaceRe.ReplaceAllString(name[:end], " "), " -")
+	return res
+}
+
+// isTag tells whether group candidate is a part of release tag rather than
+// group name (e.g. "DL" of "WEB-DL").
+func isTag(s string) bool {
+	switch strings.ToLower(s) {
+	case "dl", "rip", "ray", "sync", "cam":
+		return true
+	}
+	return yearRe.MatchString(s) || resolutionRe.MatchString(s) || sourceRe.MatchString(s) || codecRe.MatchString(s)
+}
+
+func normalize(s string) string {
+	return strings.Join(Tokens(s), "")
+}
+
+// Tokens splits name into lower case words and numbers, it is used to
+// compare titles and release names regardless of separators.
+func Tokens(s string) []string {
+	return tokenRe.FindAllString(strings.ToLower(s), -1)
+}
+
+func atoi(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
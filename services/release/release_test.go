@@ -0,0 +1,93 @@
+package release
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want Info
+	}{
+		{
+			name: "movie",
+			path: "The.Matrix.1999.1080p.BluRay.x264-GRP.mkv",
+			want: Info{Title: "The Matrix", Year: 1999, Resolution: "1080p", Source: "BluRay", Codec: "H.264", Group: "GRP"},
+		},
+		{
+			name: "episode",
+			path: "Show.Name.S02E05.720p.HDTV.x265-LOL[rarbg].mkv",
+			want: Info{Title: "Show Name", Season: 2, Episode: 5, Resolution: "720p", Source: "HDTV", Codec: "H.265", Group: "LOL"},
+		},
+		{
+			name: "cross episode",
+			path: "Show Name 3x07 480p.avi",
+			want: Info{Title: "Show Name", Season: 3, Episode: 7, Resolution: "480p"},
+		},
+		{
+			name: "web-dl without group",
+			path: "Movie.2020.1080p.WEB-DL.mkv",
+			want: Info{Title: "Movie", Year: 2020, Resolution: "1080p", Source: "WEB-DL"},
+		},
+		{
+			name: "web-dl with group",
+			path: "Movie.2020.1080p.WEB-DL.H264.AAC-EVO.mp4",
+			want: Info{Title: "Movie", Year: 2020, Resolution: "1080p", Source: "WEB-DL", Codec: "H.264", Group: "EVO"},
+		},
+		{
+			name: "hyphen in title",
+			path: "Spider-Man.2002.1080p.mkv",
+			want: Info{Title: "Spider-Man", Year: 2002, Resolution: "1080p"},
+		},
+		{
+			name: "hyphen in title without tags",
+			path: "Spider-Man.mkv",
+			want: Info{Title: "Spider-Man"},
+		},
+		{
+			name: "year in title",
+			path: "2001.A.Space.Odyssey.1968.720p.mkv",
+			want: Info{Title: "2001 A Space Odyssey", Year: 1968, Resolution: "720p"},
+		},
+		{
+			name: "telesync after year",
+			path: "Movie.2023.TS.x264-GRP.mkv",
+			want: Info{Title: "Movie", Year: 2023, Source: "TS", Codec: "H.264", Group: "GRP"},
+		},
+		{
+			name: "ts word in title",
+			path: "Ts.Story.2010.mkv",
+			want: Info{Title: "Ts Story", Year: 2010},
+		},
+		{
+			name: "4k",
+			path: "Movie (2019) 4K HEVC.mkv",
+			want: Info{Title: "Movie", Year: 2019, Resolution: "2160p", Codec: "H.265"},
+		},
+		{
+			name: "season pack",
+			path: "Show.S01.1080p.WEBRip-GRP/e03.mkv",
+			want: Info{Title: "Show", Season: 1, Resolution: "1080p", Source: "WEBRip", Group: "GRP"},
+		},
+		{
+			name: "windows path",
+			path: "Movies\\Heat.1995.DVDRip.XviD-AXL.avi",
+			want: Info{Title: "Heat", Year: 1995, Source: "DVDRip", Codec: "XviD", Group: "AXL"},
+		},
+		{
+			name: "empty",
+			path: "",
+			want: Info{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.path)
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.path, *got, tt.want)
+			}
+		})
+	}
+}
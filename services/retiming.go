@@ -0,0 +1,74 @@
+package services
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/webtor-io/video-info/services/osdb"
+	"github.com/webtor-io/video-info/services/subconv"
+)
+
+// Retiming describes how subtitle timing should be changed on delivery
+type Retiming struct {
+	Offset  time.Duration
+	FromFPS float64
+	ToFPS   float64
+}
+
+// getRetiming reads offset (ms), from-fps and to-fps query parameters.
+// If only to-fps is provided, framerate of the subtitle is used as from-fps,
+// from-fps alone is an error.
+func getRetiming(r *http.Request, sub *osdb.Subtitle) (*Retiming, error) {
+	q := r.URL.Query()
+	res := &Retiming{}
+	if v := q.Get("offset"); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse offset=%v", v)
+		}
+		res.Offset = time.Duration(ms) * time.Millisecond
+	}
+	if v := q.Get("from-fps"); v != "" {
+		fps, err := strconv.ParseFloat(v, 64)
+		if err != nil || fps <= 0 {
+			return nil, errors.Errorf("failed to parse from-fps=%v", v)
+		}
+		res.FromFPS = fps
+	}
+	if v := q.Get("to-fps"); v != "" {
+		fps, err := strconv.ParseFloat(v, 64)
+		if err != nil || fps <= 0 {
+			return nil, errors.Errorf("failed to parse to-fps=%v", v)
+		}
+		res.ToFPS = fps
+	}
+	if res.FromFPS != 0 && res.ToFPS == 0 {
+		return nil, errors.Errorf("to-fps is required with from-fps=%v", res.FromFPS)
+	}
+	if res.ToFPS != 0 && res.FromFPS == 0 {
+		res.FromFPS = sub.Attributes.Fps
+	}
+	if res.ToFPS != 0 && res.FromFPS == 0 {
+		return nil, errors.Errorf("unknown framerate of subtitle, from-fps is required with to-fps=%v", res.ToFPS)
+	}
+	return res, nil
+}
+
+func (s *Retiming) Empty() bool {
+	return s.Offset == 0 && (s.FromFPS == 0 || s.ToFPS == 0 || s.FromFPS == s.ToFPS)
+}
+
+// Apply retimes subtitle data and renders it in format. Language is lost in
+// cached data, so it is passed separately.
+func (s *Retiming) Apply(data []byte, format string, language string) ([]byte, error) {
+	t, err := subconv.Parse(data, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse subtitle")
+	}
+	t.Language = language
+	t.ChangeFPS(s.FromFPS, s.ToFPS)
+	t.Shift(s.Offset)
+	return subconv.Write(t, format)
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webtor-io/video-info/services/osdb"
+	"github.com/webtor-io/video-info/services/subconv"
+)
+
+func TestGetRetiming(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		fps     float64
+		want    Retiming
+		wantErr bool
+	}{
+		{name: "none", query: "", want: Retiming{}},
+		{name: "offset", query: "offset=-1500", want: Retiming{Offset: -1500 * time.Millisecond}},
+		{name: "both fps", query: "from-fps=25&to-fps=23.976", want: Retiming{FromFPS: 25, ToFPS: 23.976}},
+		{name: "to fps with subtitle fps", query: "to-fps=25", fps: 23.976, want: Retiming{FromFPS: 23.976, ToFPS: 25}},
+		{name: "to fps without subtitle fps", query: "to-fps=25", wantErr: true},
+		{name: "from fps only", query: "from-fps=25", fps: 23.976, wantErr: true},
+		{name: "bad offset", query: "offset=abc", wantErr: true},
+		{name: "bad fps", query: "from-fps=0&to-fps=25", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sub osdb.Subtitle
+			sub.Attributes.Fps = tt.fps
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			got, err := getRetiming(r, &sub)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getRetiming() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("getRetiming() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetimingApplyLanguage(t *testing.T) {
+	vtt := "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n"
+	rt := &Retiming{Offset: time.Second}
+	got, err := rt.Apply([]byte(vtt), subconv.FormatTTML, "en")
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !strings.Contains(string(got), `xml:lang="en"`) {
+		t.Errorf("Apply() = %s, want xml:lang=\"en\"", got)
+	}
+	if !strings.Contains(string(got), `begin="00:00:02.000"`) {
+		t.Errorf("Apply() = %s, want cue shifted to 00:00:02.000", got)
+	}
+}
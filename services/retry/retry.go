@@ -0,0 +1,191 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+const (
+	RetryAttemptsFlag = "retry-attempts"
+	RetryMinDelayFlag = "retry-min-delay"
+	RetryMaxDelayFlag = "retry-max-delay"
+	RetryTimeoutFlag  = "retry-timeout"
+)
+
+var promRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "video_info_retries_total",
+	Help: "Total number of retried upstream requests",
+}, []string{"operation"})
+
+func RegisterPolicyFlags(f []cli.Flag) []cli.Flag {
+	return append(f,
+		cli.IntFlag{
+			Name:   RetryAttemptsFlag,
+			Usage:  "max number of attempts for upstream requests, 1 disables retries",
+			Value:  3,
+			EnvVar: "RETRY_ATTEMPTS",
+		},
+		cli.DurationFlag{
+			Name:   RetryMinDelayFlag,
+			Usage:  "delay before the first retry, doubled with every next one",
+			Value:  500 * time.Millisecond,
+			EnvVar: "RETRY_MIN_DELAY",
+		},
+		cli.DurationFlag{
+			Name:   RetryMaxDelayFlag,
+			Usage:  "max delay between retries",
+			Value:  10 * time.Second,
+			EnvVar: "RETRY_MAX_DELAY",
+		},
+		cli.DurationFlag{
+			Name:   RetryTimeoutFlag,
+			Usage:  "total time for all attempts, 0 means only request deadline is used",
+			Value:  time.Minute,
+			EnvVar: "RETRY_TIMEOUT",
+		},
+	)
+}
+
+// Policy retries transient failures with exponential backoff and jitter.
+type Policy struct {
+	attempts int
+	minDelay time.Duration
+	maxDelay time.Duration
+	timeout  time.Duration
+}
+
+func NewPolicy(c *cli.Context) *Policy {
+	return &Policy{
+		attempts: c.Int(RetryAttemptsFlag),
+		minDelay: c.Duration(RetryMinDelayFlag),
+		maxDelay: c.Duration(RetryMaxDelayFlag),
+		timeout:  c.Duration(RetryTimeoutFlag),
+	}
+}
+
+// Do calls fn until it succeeds, fails permanently, attempts are over or
+// there is no time left before the deadline. Nil policy calls fn once.
+func (s *Policy) Do(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	if s == nil {
+		return fn(ctx)
+	}
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= s.attempts || !Retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		delay := s.delay(attempt, err)
+		if d, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(d) {
+			return errors.Wrapf(err, "no time left to retry in %v", delay)
+		}
+		log.WithError(err).WithFields(log.Fields{
+			"operation": op,
+			"attempt":   attempt,
+			"delay":     delay,
+		}).Warn("retrying upstream request")
+		promRetries.WithLabelValues(op).Inc()
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// delay returns Retry-After reported by upstream or exponential backoff
+// with equal jitter.
+func (s *Policy) delay(attempt int, err error) time.Duration {
+	var ra interface{ RetryAfter() time.Duration }
+	if errors.As(err, &ra) && ra.RetryAfter() > 0 {
+		return ra.RetryAfter()
+	}
+	d := s.minDelay << (attempt - 1)
+	if d > s.maxDelay || d <= 0 {
+		d = s.maxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Retryable tells whether error is worth retrying: timeouts, connection
+// resets, 5xx and 429 responses and errors marked with Temporary.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he.Code == http.StatusTooManyRequests || he.Code == http.StatusRequestTimeout || he.Code >= 500
+	}
+	var te interface{ Temporary() bool }
+	if errors.As(err, &te) && te.Temporary() {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// HTTPError is returned on unexpected response status code.
+type HTTPError struct {
+	Code       int
+	Body       string
+	retryAfter time.Duration
+}
+
+func NewHTTPError(res *http.Response, body []byte) *HTTPError {
+	return &HTTPError{
+		Code:       res.StatusCode,
+		Body:       string(body),
+		retryAfter: ParseRetryAfter(res.Header.Get("Retry-After")),
+	}
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("got bad status code=%v with body=%v", e.Code, e.Body)
+}
+
+func (e *HTTPError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// ParseRetryAfter parses Retry-After header in seconds or HTTP date form.
+func ParseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
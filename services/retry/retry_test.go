@@ -0,0 +1,163 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return false }
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary" }
+func (temporaryError) Temporary() bool { return true }
+
+func httpError(code int, retryAfter string) *HTTPError {
+	res := &http.Response{StatusCode: code, Header: http.Header{}}
+	if retryAfter != "" {
+		res.Header.Set("Retry-After", retryAfter)
+	}
+	return NewHTTPError(res, nil)
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "canceled", err: errors.Wrap(context.Canceled, "failed"), want: false},
+		{name: "429", err: errors.Wrap(httpError(429, ""), "failed"), want: true},
+		{name: "408", err: httpError(408, ""), want: true},
+		{name: "503", err: httpError(503, ""), want: true},
+		{name: "404", err: httpError(404, ""), want: false},
+		{name: "401", err: httpError(401, ""), want: false},
+		{name: "temporary", err: errors.Wrap(temporaryError{}, "failed"), want: true},
+		{name: "timeout", err: errors.Wrap(timeoutError{}, "failed"), want: true},
+		{name: "connection reset", err: errors.Wrap(syscall.ECONNRESET, "failed"), want: true},
+		{name: "unexpected eof", err: errors.Wrap(io.ErrUnexpectedEOF, "failed"), want: true},
+		{name: "other", err: errors.New("failed"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{value: ""},
+		{value: "bogus"},
+		{value: "5", min: 5 * time.Second, max: 5 * time.Second},
+		{value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 58 * time.Second, max: time.Minute},
+		{value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), min: -2 * time.Minute, max: -58 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := ParseRetryAfter(tt.value); got < tt.min || got > tt.max {
+				t.Errorf("ParseRetryAfter(%q) = %v, want within [%v, %v]", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestDelay(t *testing.T) {
+	p := &Policy{minDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		min     time.Duration
+		max     time.Duration
+	}{
+		{name: "first", attempt: 1, err: httpError(503, ""), min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{name: "third", attempt: 3, err: httpError(503, ""), min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+		{name: "capped", attempt: 10, err: httpError(503, ""), min: 500 * time.Millisecond, max: time.Second},
+		{name: "overflow", attempt: 100, err: httpError(503, ""), min: 500 * time.Millisecond, max: time.Second},
+		{name: "retry after", attempt: 1, err: errors.Wrap(httpError(429, "3"), "failed"), min: 3 * time.Second, max: 3 * time.Second},
+		{name: "past retry after", attempt: 1, err: httpError(429, time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)), min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := p.delay(tt.attempt, tt.err); got < tt.min || got > tt.max {
+					t.Fatalf("delay() = %v, want within [%v, %v]", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	p := &Policy{attempts: 3, minDelay: time.Millisecond, maxDelay: time.Millisecond}
+	tests := []struct {
+		name   string
+		policy *Policy
+		errs   []error
+		calls  int
+		err    bool
+	}{
+		{name: "success", policy: p, errs: []error{nil}, calls: 1},
+		{name: "retried", policy: p, errs: []error{httpError(503, ""), httpError(429, ""), nil}, calls: 3},
+		{name: "attempts are over", policy: p, errs: []error{httpError(503, ""), httpError(503, ""), httpError(503, ""), nil}, calls: 3, err: true},
+		{name: "not retryable", policy: p, errs: []error{httpError(404, ""), nil}, calls: 1, err: true},
+		{name: "nil policy", policy: nil, errs: []error{httpError(503, ""), nil}, calls: 1, err: true},
+		{
+			name:   "no time left",
+			policy: &Policy{attempts: 3, minDelay: time.Hour, maxDelay: time.Hour, timeout: time.Second},
+			errs:   []error{httpError(503, ""), nil},
+			calls:  1,
+			err:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := tt.policy.Do(context.Background(), "test", func(ctx context.Context) error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			if (err != nil) != tt.err {
+				t.Errorf("Do() error = %v, want error %v", err, tt.err)
+			}
+			if calls != tt.calls {
+				t.Errorf("Do() calls = %v, want %v", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestDoCanceled(t *testing.T) {
+	p := &Policy{attempts: 3, minDelay: time.Hour, maxDelay: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	err := p.Do(ctx, "test", func(ctx context.Context) error {
+		calls++
+		return httpError(503, "")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Do() = %v after %v calls, want error after single call", err, calls)
+	}
+}
@@ -2,6 +2,8 @@ package s3
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -51,8 +53,47 @@ func NewS3Storage(c *cli.Context, cl *cs.S3Client) *S3Storage {
 	}
 }
 
-func (s *S3Storage) GetSub(id int, format string) ([]byte, error) {
-	key := "opensubtitles/" + strconv.Itoa(id) + "." + format
+// GetSub fetches subtitle file of specific provider.
+func (s *S3Storage) GetSub(provider string, id int, format string) ([]byte, error) {
+	return s.get(provider + "/" + strconv.Itoa(id) + "." + format)
+}
+
+func (s *S3Storage) PutSub(provider string, id int, format string, data []byte) error {
+	return s.put(provider+"/"+strconv.Itoa(id)+"."+format, data)
+}
+
+// GetEmbeddedSub fetches subtitle extracted from source container. Source is
+// identified by arbitrary key (e.g. info hash and path), which is hashed to get
+// stable object name.
+func (s *S3Storage) GetEmbeddedSub(source string, track int, format string) ([]byte, error) {
+	return s.get(embeddedKey(source, track, format))
+}
+
+func (s *S3Storage) PutEmbeddedSub(source string, track int, format string, data []byte) error {
+	return s.put(embeddedKey(source, track, format), data)
+}
+
+// GetSubtitles fetches search result kept to be served while provider is
+// down. Search is identified by its cache key.
+func (s *S3Storage) GetSubtitles(key string) ([]byte, error) {
+	return s.get(searchKey(key))
+}
+
+func (s *S3Storage) PutSubtitles(key string, data []byte) error {
+	return s.put(searchKey(key), data)
+}
+
+func searchKey(key string) string {
+	h := sha1.Sum([]byte(key))
+	return "search/" + hex.EncodeToString(h[:]) + ".json"
+}
+
+func embeddedKey(source string, track int, format string) string {
+	h := sha1.Sum([]byte(source))
+	return "embedded/" + hex.EncodeToString(h[:]) + "/" + strconv.Itoa(track) + "." + format
+}
+
+func (s *S3Storage) get(key string) ([]byte, error) {
 	log.Infof("fetching sub key=%v bucket=%v", key, s.bucket)
 	r, err := s.cl.Get().GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
@@ -74,8 +115,7 @@ func (s *S3Storage) GetSub(id int, format string) ([]byte, error) {
 	return b, nil
 }
 
-func (s *S3Storage) PutSub(id int, format string, data []byte) (err error) {
-	key := "opensubtitles/" + strconv.Itoa(id) + "." + format
+func (s *S3Storage) put(key string, data []byte) (err error) {
 	log.Infof("storing sub key=%v bucket=%v", key, s.bucket)
 	_, err = s.cl.Get().PutObject(&s3.PutObjectInput{
 		Bucket: aws.String(s.bucket),
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/webtor-io/video-info/services/osdb"
+	"github.com/webtor-io/video-info/services/redis"
+	s "github.com/webtor-io/video-info/services/s3"
+)
+
+// subtitlesCache keeps search results, it is implemented by redis.Cache.
+type subtitlesCache interface {
+	Key() string
+	GetSubtitles(ctx context.Context) ([]osdb.Subtitle, redis.Freshness, error)
+	SetSubtitles(ctx context.Context, subs []osdb.Subtitle) error
+}
+
+// searchFunc searches subtitles with provider.
+type searchFunc func(ctx context.Context, purge bool) ([]osdb.Subtitle, error)
+
+// searchPool shares searches made with the same provider, key and languages
+// and refreshes expiring results in background.
+type searchPool struct {
+	sm        sync.Map
+	refresher refresher
+	s3        *s.S3Storage
+}
+
+func (s *searchPool) get(ctx context.Context, p Provider, key string, languages []string, c subtitlesCache, purge bool, search searchFunc) ([]osdb.Subtitle, error) {
+	key = p.Name() + "|" + key + "|" + strings.Join(languages, ",")
+	v, loaded := s.sm.LoadOrStore(key, newCachedSearch(p, languages, c, s.s3, search))
+	if !loaded {
+		defer s.sm.Delete(key)
+	}
+	sr := v.(*cachedSearch)
+	subs, err := sr.Get(ctx, purge)
+	if sr.Expiring() {
+		s.refresher.run(key, newCachedSearch(p, languages, c, s.s3, search).Refresh)
+	}
+	return subs, err
+}
+
+// cachedSearch makes single search through cache.
+type cachedSearch struct {
+	p         Provider
+	languages []string
+	cache     subtitlesCache
+	s3        *s.S3Storage
+	search    searchFunc
+	value     []osdb.Subtitle
+	inited    bool
+	expiring  bool
+	err       error
+	mux       sync.Mutex
+}
+
+func newCachedSearch(p Provider, languages []string, c subtitlesCache, st *s.S3Storage, search searchFunc) *cachedSearch {
+	return &cachedSearch{p: p, languages: languages, cache: c, s3: st, search: search}
+}
+
+func (s *cachedSearch) Get(ctx context.Context, purge bool) ([]osdb.Subtitle, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if purge {
+		s.inited = false
+	}
+	if s.inited {
+		return s.value, s.err
+	}
+	s.value, s.expiring, s.err = getCachedSubtitles(ctx, s.p, s.cache, s.s3, s.languages, purge, func(ctx context.Context) ([]osdb.Subtitle, error) {
+		return s.fetch(ctx, purge)
+	})
+	s.inited = true
+	return s.value, s.err
+}
+
+// Expiring tells whether subtitles were served from cache older than soft
+// TTL, so they should be refreshed.
+func (s *cachedSearch) Expiring() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.expiring
+}
+
+// Refresh searches subtitles again and updates cached ones.
+func (s *cachedSearch) Refresh(ctx context.Context) error {
+	_, err := s.fetch(ctx, false)
+	return err
+}
+
+// fetch searches subtitles with provider and stores them in cache.
+func (s *cachedSearch) fetch(ctx context.Context, purge bool) ([]osdb.Subtitle, error) {
+	subtitles, err := s.search(ctx, purge)
+	if err != nil {
+		return nil, err
+	}
+	if isVolatile(s.p) {
+		return subtitles, nil
+	}
+	err = storeSubtitles(ctx, s.cache, s.s3, subtitles)
+	if err != nil {
+		return nil, err
+	}
+	return subtitles, nil
+}
+
+// getCachedSubtitles serves search result from cache or fetches it with
+// provider. While provider is down the last known result from redis or s3 is
+// served flagged stale. expiring is true for result older than soft TTL.
+func getCachedSubtitles(ctx context.Context, p Provider, c subtitlesCache, st *s.S3Storage, languages []string, purge bool, fetch func(ctx context.Context) ([]osdb.Subtitle, error)) (subs []osdb.Subtitle, expiring bool, err error) {
+	if isVolatile(p) {
+		subs, err = fetch(ctx)
+		return subs, false, err
+	}
+	cached, freshness, err := c.GetSubtitles(ctx)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to get subtitles from cache")
+	}
+	if !purge && (freshness == redis.Fresh || freshness == redis.SoftExpired) {
+		return filterByLanguages(cached, languages), freshness == redis.SoftExpired, nil
+	}
+	if !isAvailable(p) {
+		if stale := getStaleSubtitles(cached, c, st, languages); stale != nil {
+			return stale, false, nil
+		}
+	}
+	subs, err = fetch(ctx)
+	// failed call may have just opened circuit breaker
+	if err != nil && !isAvailable(p) {
+		if stale := getStaleSubtitles(cached, c, st, languages); stale != nil {
+			return stale, false, nil
+		}
+	}
+	return subs, false, err
+}
+
+// getStaleSubtitles returns last known search result, s3 copy is used when
+// redis has nothing. Returns nil if nothing is known.
+func getStaleSubtitles(cached []osdb.Subtitle, c subtitlesCache, st *s.S3Storage, languages []string) []osdb.Subtitle {
+	if len(cached) == 0 && st != nil {
+		d, err := st.GetSubtitles(c.Key())
+		if err != nil {
+			log.WithError(err).Warn("failed to get subtitles from s3")
+		}
+		if d != nil {
+			if err := json.Unmarshal(d, &cached); err != nil {
+				log.WithError(err).Warn("failed to decode subtitles from s3")
+			}
+		}
+	}
+	if len(cached) == 0 {
+		return nil
+	}
+	return markStale(filterByLanguages(cached, languages))
+}
+
+// storeSubtitles stores search result in cache, non-empty one is also kept
+// in s3 to be served while provider is down.
+func storeSubtitles(ctx context.Context, c subtitlesCache, st *s.S3Storage, subs []osdb.Subtitle) error {
+	err := c.SetSubtitles(ctx, subs)
+	if err != nil {
+		return errors.Wrap(err, "failed to store subtitles in cache")
+	}
+	if st == nil || len(subs) == 0 {
+		return nil
+	}
+	d, err := json.Marshal(subs)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode subtitles")
+	}
+	err = st.PutSubtitles(c.Key(), d)
+	if err != nil {
+		return errors.Wrap(err, "failed to store subtitles in s3")
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/webtor-io/video-info/services/osdb"
+	"github.com/webtor-io/video-info/services/redis"
+)
+
+// testCache keeps search result in memory with given freshness.
+type testCache struct {
+	subs      []osdb.Subtitle
+	freshness redis.Freshness
+	stored    bool
+	mux       sync.Mutex
+}
+
+func (s *testCache) Key() string {
+	return "test"
+}
+
+func (s *testCache) GetSubtitles(_ context.Context) ([]osdb.Subtitle, redis.Freshness, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.subs, s.freshness, nil
+}
+
+func (s *testCache) SetSubtitles(_ context.Context, subs []osdb.Subtitle) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.subs = subs
+	s.freshness = redis.Fresh
+	s.stored = true
+	return nil
+}
+
+func (s *testCache) isStored() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.stored
+}
+
+type testProvider struct {
+	Provider
+	volatile bool
+	down     bool
+}
+
+func (s *testProvider) Name() string    { return "test" }
+func (s *testProvider) Volatile() bool  { return s.volatile }
+func (s *testProvider) Available() bool { return !s.down }
+
+func testSub(id string, lang string) osdb.Subtitle {
+	var sub osdb.Subtitle
+	sub.Id = id
+	sub.Attributes.Language = lang
+	return sub
+}
+
+func subIDs(subs []osdb.Subtitle) []string {
+	var res []string
+	for _, s := range subs {
+		res = append(res, s.Id)
+	}
+	return res
+}
+
+func TestCachedSearch(t *testing.T) {
+	cached := []osdb.Subtitle{testSub("1", "en"), testSub("2", "fr")}
+	found := []osdb.Subtitle{testSub("3", "en")}
+	tests := []struct {
+		name         string
+		provider     *testProvider
+		cached       []osdb.Subtitle
+		freshness    redis.Freshness
+		purge        bool
+		err          error
+		want         []string
+		wantStale    bool
+		wantExpiring bool
+		wantCalls    int
+		wantStored   bool
+		wantErr      bool
+	}{
+		{name: "missing", provider: &testProvider{}, freshness: redis.Missing, want: []string{"3"}, wantCalls: 1, wantStored: true},
+		{name: "fresh", provider: &testProvider{}, cached: cached, freshness: redis.Fresh, want: []string{"1"}},
+		{name: "fresh empty", provider: &testProvider{}, freshness: redis.Fresh},
+		{name: "soft expired", provider: &testProvider{}, cached: cached, freshness: redis.SoftExpired, want: []string{"1"}, wantExpiring: true},
+		{name: "hard expired", provider: &testProvider{}, cached: cached, freshness: redis.HardExpired, want: []string{"3"}, wantCalls: 1, wantStored: true},
+		{name: "purged", provider: &testProvider{}, cached: cached, freshness: redis.Fresh, purge: true, want: []string{"3"}, wantCalls: 1, wantStored: true},
+		{name: "hard expired while down", provider: &testProvider{down: true}, cached: cached, freshness: redis.HardExpired, want: []string{"1"}, wantStale: true},
+		{name: "missing while down", provider: &testProvider{down: true}, freshness: redis.Missing, err: errors.New("down"), wantCalls: 1, wantErr: true},
+		{name: "failed", provider: &testProvider{}, cached: cached, freshness: redis.HardExpired, err: errors.New("failed"), wantCalls: 1, wantErr: true},
+		{name: "volatile", provider: &testProvider{volatile: true}, cached: cached, freshness: redis.Fresh, want: []string{"3"}, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &testCache{subs: tt.cached, freshness: tt.freshness}
+			calls := 0
+			sr := newCachedSearch(tt.provider, []string{"en"}, c, nil, func(_ context.Context, _ bool) ([]osdb.Subtitle, error) {
+				calls++
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return found, nil
+			})
+			subs, err := sr.Get(context.Background(), tt.purge)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := subIDs(subs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get() = %v, want %v", got, tt.want)
+			}
+			for _, s := range subs {
+				if s.Stale != tt.wantStale {
+					t.Errorf("Get() stale = %v, want %v", s.Stale, tt.wantStale)
+				}
+			}
+			if got := sr.Expiring(); got != tt.wantExpiring {
+				t.Errorf("Expiring() = %v, want %v", got, tt.wantExpiring)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("search calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if c.stored != tt.wantStored {
+				t.Errorf("stored = %v, want %v", c.stored, tt.wantStored)
+			}
+			// second call is served from memory
+			if _, err := sr.Get(context.Background(), false); (err != nil) != tt.wantErr || calls != tt.wantCalls {
+				t.Errorf("second Get() error = %v, search calls = %v, want %v", err, calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSearchPoolRefresh(t *testing.T) {
+	c := &testCache{subs: []osdb.Subtitle{testSub("1", "en")}, freshness: redis.SoftExpired}
+	var sp searchPool
+	subs, err := sp.get(context.Background(), &testProvider{}, "key", []string{"en"}, c, false, func(_ context.Context, _ bool) ([]osdb.Subtitle, error) {
+		return []osdb.Subtitle{testSub("2", "en")}, nil
+	})
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if got := subIDs(subs); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("get() = %v, want soft expired [1]", got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !c.isStored() {
+		if time.Now().After(deadline) {
+			t.Fatal("soft expired subtitles were not refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	subs, _, _ = c.GetSubtitles(context.Background())
+	if got := subIDs(subs); !reflect.DeepEqual(got, []string{"2"}) {
+		t.Errorf("refreshed subtitles = %v, want [2]", got)
+	}
+}
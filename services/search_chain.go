@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"github.com/webtor-io/video-info/services/osdb"
+	"github.com/webtor-io/video-info/services/redis"
+	"github.com/webtor-io/video-info/services/release"
+)
+
+const (
+	SearchStrategiesFlag = "search-strategies"
+	SearchMinResultsFlag = "search-min-results"
+)
+
+const (
+	StrategyHash  = "hash"
+	StrategyIMDB  = "imdb"
+	StrategyQuery = "query"
+)
+
+// SearchRequest holds everything known about the video to find subtitles for
+type SearchRequest struct {
+	SourceURL string
+	Path      string
+	IMDBID    string
+	Query     osdb.Query
+	Languages []string
+	CacheKey  string
+}
+
+// SearchChain runs search strategies one by one until enough subtitles
+// are found. Every strategy queries all providers, every subtitle is tagged
+// with the strategy it was found with and with its provider.
+type SearchChain struct {
+	strategies      []string
+	providers       *Providers
+	minResults      int
+	searchPool      *SearchPool
+	imdbSearchPool  *IMDBSearchPool
+	querySearchPool *QuerySearchPool
+	cachePool       *redis.CachePool
+}
+
+func RegisterSearchChainFlags(f []cli.Flag) []cli.Flag {
+	return append(f,
+		cli.StringFlag{
+			Name:   SearchStrategiesFlag,
+			Usage:  "comma separated search strategies in order of priority (hash, imdb, query)",
+			Value:  strings.Join([]string{StrategyHash, StrategyIMDB, StrategyQuery}, ","),
+			EnvVar: "SEARCH_STRATEGIES",
+		},
+		cli.IntFlag{
+			Name:   SearchMinResultsFlag,
+			Usage:  "stop search chain when at least this number of subtitles is found",
+			Value:  1,
+			EnvVar: "SEARCH_MIN_RESULTS",
+		},
+	)
+}
+
+func NewSearchChain(c *cli.Context, pr *Providers, sp *SearchPool, isp *IMDBSearchPool, qsp *QuerySearchPool, cp *redis.CachePool) *SearchChain {
+	var strategies []string
+	for _, st := range strings.Split(c.String(SearchStrategiesFlag), ",") {
+		st = strings.ToLower(strings.TrimSpace(st))
+		if st != "" {
+			strategies = append(strategies, st)
+		}
+	}
+	return &SearchChain{
+		strategies:      strategies,
+		minResults:      c.Int(SearchMinResultsFlag),
+		providers:       pr,
+		searchPool:      sp,
+		imdbSearchPool:  isp,
+		querySearchPool: qsp,
+		cachePool:       cp,
+	}
+}
+
+func (s *SearchChain) searchBy(ctx context.Context, p Provider, strategy string, r *SearchRequest, purge bool, logger *log.Entry) ([]osdb.Subtitle, bool, error) {
+	cache := s.cachePool.Get(r.CacheKey + p.Name() + strategy)
+	switch strategy {
+	case StrategyHash:
+		if r.SourceURL == "" {
+			return nil, false, nil
+		}
+		logger.Info("fetching subtitles by hash and file size")
+		subs, err := s.searchPool.Get(ctx, p, r.SourceURL, r.Languages, cache, purge)
+		return subs, true, err
+	case StrategyIMDB:
+		if r.IMDBID == "" {
+			return nil, false, nil
+		}
+		logger.Info("fetching subtitles by IMDB id")
+		subs, err := s.imdbSearchPool.Get(ctx, p, r.IMDBID, r.Languages, cache, purge)
+		return subs, true, err
+	case StrategyQuery:
+		q := r.Query
+		if q.Empty() && r.Path != "" {
+			q = makeReleaseQuery(release.Parse(r.Path))
+		}
+		if q.Empty() {
+			return nil, false, nil
+		}
+		logger.WithField("query", q).Info("fetching subtitles by query")
+		subs, err := s.querySearchPool.Get(ctx, p, q, r.Languages, cache, purge)
+		return subs, true, err
+	}
+	return nil, false, errors.Errorf("unknown search strategy %v", strategy)
+}
+
+func (s *SearchChain) Search(ctx context.Context, r *SearchRequest, purge bool, logger *log.Entry) ([]osdb.Subtitle, error) {
+	var res []osdb.Subtitle
+	var lastErr error
+	applied := false
+	seen := map[string]bool{}
+	for _, st := range s.strategies {
+		for _, p := range s.providers.List() {
+			l := logger.WithField("provider", p.Name())
+			subs, ok, err := s.searchBy(ctx, p, st, r, purge, l)
+			if !ok && err == nil {
+				continue
+			}
+			applied = true
+			if err != nil {
+				l.WithError(err).WithField("strategy", st).Warn("failed to fetch subtitles")
+				lastErr = err
+				continue
+			}
+			for _, sub := range subs {
+				key := p.Name() + "/" + sub.Id
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				sub.MatchedBy = st
+				sub.Provider = p.Name()
+				res = append(res, sub)
+			}
+		}
+		if len(res) >= s.minResults {
+			break
+		}
+	}
+	if !applied {
+		return nil, errors.Errorf("no data provided to find subtitles")
+	}
+	if len(res) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return res, nil
+}
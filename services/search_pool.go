@@ -2,29 +2,36 @@ package services
 
 import (
 	"context"
-	"github.com/webtor-io/video-info/services/osdb"
-	"sync"
 
+	"github.com/pkg/errors"
+	"github.com/webtor-io/video-info/services/osdb"
 	"github.com/webtor-io/video-info/services/redis"
+	"github.com/webtor-io/video-info/services/retry"
+	"github.com/webtor-io/video-info/services/s3"
 )
 
 type SearchPool struct {
-	sm       sync.Map
-	cl       *osdb.Client
+	searchPool
 	hashPool *HashPool
 }
 
-func NewSearchPool(cl *osdb.Client) *SearchPool {
+func NewSearchPool(r *retry.Policy, st *s3.S3Storage) *SearchPool {
 	return &SearchPool{
-		hashPool: NewHashPool(),
-		cl:       cl,
+		searchPool: searchPool{s3: st},
+		hashPool:   NewHashPool(r),
 	}
 }
 
-func (s *SearchPool) Get(ctx context.Context, url string, c *redis.Cache, purge bool) ([]osdb.Subtitle, error) {
-	v, loaded := s.sm.LoadOrStore(url, NewSearch(url, s.hashPool, s.cl, c))
-	if !loaded {
-		defer s.sm.Delete(url)
-	}
-	return v.(*Search).Get(ctx, purge)
+func (s *SearchPool) Get(ctx context.Context, p Provider, url string, languages []string, c *redis.Cache, purge bool) ([]osdb.Subtitle, error) {
+	return s.get(ctx, p, url, languages, c, purge, func(ctx context.Context, purge bool) ([]osdb.Subtitle, error) {
+		hash, size, err := s.hashPool.Get(ctx, url, c, purge)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get hash")
+		}
+		subtitles, err := p.SearchByHash(ctx, hash, size, languages)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get subtitles")
+		}
+		return subtitles, nil
+	})
 }
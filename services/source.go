@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/webtor-io/video-info/services/retry"
+)
+
+const (
+	rangeBlockSize   = 64 * 1024
+	rangeCacheBlocks = 64
+)
+
+// rangeReader reads source with exact range requests caching recently read
+// blocks. It never fetches more than needed, so it fits many small
+// scattered reads.
+type rangeReader struct {
+	ctx    context.Context
+	url    string
+	cl     *http.Client
+	retry  *retry.Policy
+	size   int64
+	blocks map[int64][]byte
+	order  []int64
+	mux    sync.Mutex
+}
+
+// newSourceRangeReader makes range reader bound to ctx, every range request
+// is retried with rp.
+func newSourceRangeReader(ctx context.Context, url string, rp *retry.Policy) *rangeReader {
+	return &rangeReader{
+		ctx: ctx,
+		url: url,
+		cl: &http.Client{
+			Timeout: 5 * time.Minute,
+		},
+		retry:  rp,
+		size:   -1,
+		blocks: map[int64][]byte{},
+	}
+}
+
+func (s *rangeReader) fetch(off int64, length int64) (d []byte, size int64, err error) {
+	err = s.retry.Do(s.ctx, "source_range_read", func(ctx context.Context) (err error) {
+		d, size, err = s.fetchOnce(ctx, off, length)
+		return
+	})
+	return
+}
+
+func (s *rangeReader) fetchOnce(ctx context.Context, off int64, length int64) ([]byte, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url, nil)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to make range request")
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%v-%v", off, off+length-1))
+	res, err := s.cl.Do(req)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to do range request")
+	}
+	defer res.Body.Close()
+	size := int64(-1)
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		if _, total, ok := strings.Cut(res.Header.Get("Content-Range"), "/"); ok {
+			size, _ = strconv.ParseInt(total, 10, 64)
+		}
+	case http.StatusOK:
+		size = res.ContentLength
+		if _, err := io.CopyN(io.Discard, res.Body, off); err != nil {
+			return nil, 0, errors.Wrap(err, "failed to skip data")
+		}
+	default:
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, 0, errors.Wrap(retry.NewHTTPError(res, b), "failed to do range request")
+	}
+	d, err := io.ReadAll(io.LimitReader(res.Body, length))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to read range data")
+	}
+	if int64(len(d)) < length && (size < 0 || off+int64(len(d)) < size) {
+		return nil, 0, errors.Wrap(io.ErrUnexpectedEOF, "got short range data")
+	}
+	return d, size, nil
+}
+
+func (s *rangeReader) Size() (int64, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.size >= 0 {
+		return s.size, nil
+	}
+	_, size, err := s.fetch(0, 1)
+	if err != nil {
+		return 0, err
+	}
+	if size < 0 {
+		return 0, errors.New("failed to get source size")
+	}
+	s.size = size
+	return size, nil
+}
+
+func (s *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	size, err := s.Size()
+	if err != nil {
+		return 0, err
+	}
+	if off >= size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > size {
+		end = size
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if end-off > rangeBlockSize*4 {
+		d, _, err := s.fetch(off, end-off)
+		if err != nil {
+			return 0, err
+		}
+		n := copy(p, d)
+		if n < len(p) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+	first := off / rangeBlockSize * rangeBlockSize
+	var missing []int64
+	for b := first; b < end; b += rangeBlockSize {
+		if _, ok := s.blocks[b]; !ok {
+			missing = append(missing, b)
+		}
+	}
+	if len(missing) > 0 {
+		from := missing[0]
+		to := missing[len(missing)-1] + rangeBlockSize
+		if to > size {
+			to = size
+		}
+		d, _, err := s.fetch(from, to-from)
+		if err != nil {
+			return 0, err
+		}
+		for b := from; b < to; b += rangeBlockSize {
+			if _, ok := s.blocks[b]; ok || b-from >= int64(len(d)) {
+				continue
+			}
+			be := b - from + rangeBlockSize
+			if be > int64(len(d)) {
+				be = int64(len(d))
+			}
+			s.blocks[b] = d[b-from : be]
+			s.order = append(s.order, b)
+		}
+	}
+	n := 0
+	for b := first; b < end; b += rangeBlockSize {
+		d, ok := s.blocks[b]
+		if !ok {
+			break
+		}
+		from := int64(0)
+		if b < off {
+			from = off - b
+		}
+		if from >= int64(len(d)) {
+			break
+		}
+		n += copy(p[n:], d[from:])
+	}
+	for len(s.order) > rangeCacheBlocks {
+		delete(s.blocks, s.order[0])
+		s.order = s.order[1:]
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -2,7 +2,9 @@ package services
 
 import (
 	"context"
+	"github.com/webtor-io/video-info/services/charset"
 	"github.com/webtor-io/video-info/services/osdb"
+	"github.com/webtor-io/video-info/services/subconv"
 	"sync"
 
 	"github.com/sirupsen/logrus"
@@ -13,64 +15,131 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	OriginalFormat = "original"
+	mergedPrefix   = "merged-"
+)
+
 type Sub struct {
-	cl     *osdb.Client
+	p      Provider
 	sub    *osdb.Subtitle
+	id     int
 	format string
+	orig   *Sub
+	parts  []*Sub
 	cache  *redis.Cache
 	s3     *s.S3Storage
 	value  []byte
+	stale  bool
 	inited bool
 	err    error
 	mux    sync.Mutex
 	logger *logrus.Entry
 }
 
-func NewSub(sub *osdb.Subtitle, format string, cl *osdb.Client, c *redis.Cache, s3 *s.S3Storage, logger *logrus.Entry) *Sub {
+// NewSub makes subtitle file in specific format. Every format except OriginalFormat
+// is converted locally from orig, so the original file is downloaded only once.
+func NewSub(sub *osdb.Subtitle, id int, format string, orig *Sub, p Provider, c *redis.Cache, s3 *s.S3Storage, logger *logrus.Entry) *Sub {
 	return &Sub{
 		sub:    sub,
+		id:     id,
 		format: format,
+		orig:   orig,
 		cache:  c,
 		logger: logger,
 		s3:     s3,
-		cl:     cl,
+		p:      p,
 	}
 }
 
-func (s *Sub) get(ctx context.Context, purge bool) ([]byte, error) {
-	if len(s.sub.Attributes.Files) == 0 {
-		return nil, errors.Errorf("no files for subtitle")
+// NewMergedSub makes single subtitle in specific format from all parts of
+// multi-CD subtitle. parts are original files ordered by CD number.
+func NewMergedSub(sub *osdb.Subtitle, format string, parts []*Sub, p Provider, c *redis.Cache, s3 *s.S3Storage, logger *logrus.Entry) *Sub {
+	return &Sub{
+		sub:    sub,
+		id:     parts[0].id,
+		format: format,
+		parts:  parts,
+		cache:  c,
+		logger: logger,
+		s3:     s3,
+		p:      p,
+	}
+}
+
+func (s *Sub) storeFormat() string {
+	if s.parts != nil {
+		return mergedPrefix + s.format
+	}
+	return s.format
+}
+
+func (s *Sub) getCached(ctx context.Context) ([]byte, error) {
+	subtitle, err := s.cache.GetSubtitle(ctx, s.p.Name(), s.id, s.storeFormat())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get subtitle from cache")
+	}
+	if subtitle != nil || s.s3 == nil {
+		return subtitle, nil
+	}
+	subtitle, err = s.s3.GetSub(s.p.Name(), s.id, s.storeFormat())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get subtitle from s3")
 	}
-	id := s.sub.Attributes.Files[0].FileId
-	if !purge {
-		subtitle, err := s.cache.GetSubtitle(ctx, id, s.format)
+	return subtitle, nil
+}
+
+func (s *Sub) get(ctx context.Context, purge bool) ([]byte, error) {
+	id := s.id
+	format := s.storeFormat()
+	cache := !isVolatile(s.p)
+	s.stale = false
+	// purged subtitle is served from previous copy while provider is down
+	if cache && (!purge || !isAvailable(s.p)) {
+		subtitle, err := s.getCached(ctx)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to get subtitle from cache")
+			return nil, err
 		}
 		if subtitle != nil {
+			s.stale = purge
 			return subtitle, nil
 		}
-		if s.s3 != nil {
-			subtitle, err := s.s3.GetSub(id, s.format)
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to get subtitle from s3")
-			}
-			if subtitle != nil {
+	}
+	var d []byte
+	var err error
+	if s.parts != nil {
+		d, err = s.merge(ctx, purge)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to merge subtitle")
+		}
+	} else if s.format == OriginalFormat {
+		d, err = s.download(ctx)
+		// failed download may have just opened circuit breaker
+		if err != nil && cache && !isAvailable(s.p) {
+			if subtitle, _ := s.getCached(ctx); subtitle != nil {
+				s.stale = true
 				return subtitle, nil
 			}
 		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to download subtitle")
+		}
+	} else {
+		d, err = s.convert(ctx, purge)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert subtitle")
+		}
 	}
-	d, err := s.cl.DownloadSubtitle(ctx, id, s.format)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to download subtitle")
+	if !cache || s.stale {
+		return d, nil
 	}
-	err = s.cache.SetSubtitle(ctx, id, s.format, d)
+	err = s.cache.SetSubtitle(ctx, s.p.Name(), id, format, d)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to store subtitle in cache")
 	}
 
 	if s.s3 != nil {
-		err := s.s3.PutSub(id, s.format, d)
+		err := s.s3.PutSub(s.p.Name(), id, format, d)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to store subtitle in s3")
 		}
@@ -78,6 +147,62 @@ func (s *Sub) get(ctx context.Context, purge bool) ([]byte, error) {
 	return d, nil
 }
 
+// download fetches original subtitle file and normalizes it to UTF-8.
+func (s *Sub) download(ctx context.Context) ([]byte, error) {
+	d, err := s.p.Download(ctx, s.sub, s.id)
+	if err != nil {
+		return nil, err
+	}
+	d, cs, err := charset.ToUTF8(d, s.sub.Attributes.Language)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert subtitle to utf-8")
+	}
+	s.logger.WithField("charset", cs).WithField("fileID", s.id).Info("detected subtitle charset")
+	if isVolatile(s.p) {
+		return d, nil
+	}
+	err = s.cache.SetSubtitleCharset(ctx, s.p.Name(), s.id, cs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to store subtitle charset in cache")
+	}
+	return d, nil
+}
+
+func (s *Sub) parse(ctx context.Context, orig *Sub, purge bool) (*subconv.Track, error) {
+	o, err := orig.Get(ctx, purge)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get original subtitle")
+	}
+	t, err := subconv.Parse(o, s.sub.Attributes.Fps)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse original subtitle")
+	}
+	t.Language = s.sub.Attributes.Language
+	return t, nil
+}
+
+func (s *Sub) convert(ctx context.Context, purge bool) ([]byte, error) {
+	t, err := s.parse(ctx, s.orig, purge)
+	if err != nil {
+		return nil, err
+	}
+	s.stale = s.orig.Stale()
+	return subconv.Write(t, s.format)
+}
+
+func (s *Sub) merge(ctx context.Context, purge bool) ([]byte, error) {
+	var tracks []*subconv.Track
+	for i, p := range s.parts {
+		t, err := s.parse(ctx, p, purge)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get part=%v", i+1)
+		}
+		tracks = append(tracks, t)
+		s.stale = s.stale || p.Stale()
+	}
+	return subconv.Write(subconv.Concat(tracks...), s.format)
+}
+
 func (s *Sub) Get(ctx context.Context, purge bool) ([]byte, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
@@ -88,6 +213,15 @@ func (s *Sub) Get(ctx context.Context, purge bool) ([]byte, error) {
 		return s.value, s.err
 	}
 	s.value, s.err = s.get(ctx, purge)
-	s.inited = true
+	// quota and circuit breaker errors are temporary, so the next request tries again
+	var qe *osdb.QuotaError
+	s.inited = !errors.As(s.err, &qe) && !isCircuitOpen(s.err)
 	return s.value, s.err
 }
+
+// Stale tells whether subtitle was served from previous copy while provider is down.
+func (s *Sub) Stale() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.stale
+}
@@ -0,0 +1,98 @@
+package subconv
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultFPS = 23.976
+)
+
+var (
+	microDVDRe     = regexp.MustCompile(`^\{(\d+)\}\{(\d*)\}(.*)$`)
+	mpl2Re         = regexp.MustCompile(`^\[(\d+)\]\[(\d*)\](.*)$`)
+	microDVDCtrlRe = regexp.MustCompile(`\{([yY]):([^}]*)\}`)
+	microDVDAnyRe  = regexp.MustCompile(`\{[^}]*\}`)
+)
+
+// ParseMicroDVD parses MicroDVD ({start}{end}text, frame based) and
+// MPL2 ([start][end]text, deciseconds based) subtitles. Frames are converted
+// with fps, unless the file itself declares a framerate in its first cue.
+func ParseMicroDVD(data string, fps float64) (*Track, error) {
+	if fps <= 0 {
+		fps = DefaultFPS
+	}
+	t := &Track{}
+	for i, l := range splitLines(data) {
+		l = strings.TrimSpace(l)
+		if m := microDVDRe.FindStringSubmatch(l); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			end, _ := strconv.Atoi(m[2])
+			if i == 0 && start <= 1 && end <= 1 {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(m[3]), 64); err == nil && f > 0 {
+					fps = f
+					continue
+				}
+			}
+			t.appendCue(frameDuration(start, fps), frameDuration(end, fps), microDVDText(m[3]))
+		} else if m := mpl2Re.FindStringSubmatch(l); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			end, _ := strconv.Atoi(m[2])
+			t.appendCue(time.Duration(start)*100*time.Millisecond, time.Duration(end)*100*time.Millisecond, microDVDText(m[3]))
+		}
+	}
+	if len(t.Cues) == 0 {
+		return nil, ErrNoCues
+	}
+	return t, nil
+}
+
+func frameDuration(frame int, fps float64) time.Duration {
+	return time.Duration(float64(frame) / fps * float64(time.Second))
+}
+
+// microDVDText converts "|" separated lines with {y:i}-like control codes
+// and "/" italic prefixes into cue text. Lowercase control codes apply to
+// a single line, uppercase ones to the whole cue.
+func microDVDText(text string) string {
+	var global []string
+	if m := microDVDCtrlRe.FindStringSubmatch(text); m != nil && m[1] == "Y" && strings.HasPrefix(text, m[0]) {
+		global = styleTags(m[2])
+		text = strings.TrimPrefix(text, m[0])
+	}
+	var lines []string
+	for _, l := range strings.Split(text, "|") {
+		var tags []string
+		if strings.HasPrefix(l, "/") {
+			tags = append(tags, "i")
+			l = l[1:]
+		}
+		for _, m := range microDVDCtrlRe.FindAllStringSubmatch(l, -1) {
+			tags = append(tags, styleTags(m[2])...)
+		}
+		l = microDVDAnyRe.ReplaceAllString(l, "")
+		lines = append(lines, wrapTags(l, tags))
+	}
+	return wrapTags(strings.Join(lines, "\n"), global)
+}
+
+func styleTags(s string) []string {
+	var tags []string
+	for _, st := range strings.Split(strings.ToLower(s), ",") {
+		st = strings.TrimSpace(st)
+		if st == "i" || st == "b" || st == "u" {
+			tags = append(tags, st)
+		}
+	}
+	return tags
+}
+
+func wrapTags(text string, tags []string) string {
+	for _, t := range tags {
+		text = "<" + t + ">" + text + "</" + t + ">"
+	}
+	return text
+}
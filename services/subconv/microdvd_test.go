@@ -0,0 +1,66 @@
+package subconv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMicroDVD(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		fps  float64
+		want []Cue
+	}{
+		{
+			name: "default fps",
+			data: "{0}{23976}Hello|world\n",
+			want: []Cue{
+				{Start: 0, End: ms(1000000), Text: "Hello\nworld"},
+			},
+		},
+		{
+			name: "explicit fps",
+			data: "{25}{50}One\n",
+			fps:  25,
+			want: []Cue{
+				{Start: ms(1000), End: ms(2000), Text: "One"},
+			},
+		},
+		{
+			name: "framerate header",
+			data: "{1}{1}25.000\n{50}{75}Two\n",
+			fps:  30,
+			want: []Cue{
+				{Start: ms(2000), End: ms(3000), Text: "Two"},
+			},
+		},
+		{
+			name: "control codes",
+			data: "{0}{25}{Y:b}Line|/Italic|{y:u}Under{c:$0000ff}\n",
+			fps:  25,
+			want: []Cue{
+				{Start: 0, End: ms(1000), Text: "<b>Line\n<i>Italic</i>\n<u>Under</u></b>"},
+			},
+		},
+		{
+			name: "mpl2",
+			data: "[10][25]Hello|world\n[30][]No end\n",
+			want: []Cue{
+				{Start: ms(1000), End: ms(2500), Text: "Hello\nworld"},
+				{Start: ms(3000), End: ms(5000), Text: "No end"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMicroDVD(tt.data, tt.fps)
+			if err != nil {
+				t.Fatalf("ParseMicroDVD() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Cues, tt.want) {
+				t.Errorf("ParseMicroDVD() = %+v, want %+v", got.Cues, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package subconv
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	srtTimingRe = regexp.MustCompile(`^\s*(\d+):(\d{1,2}):(\d{1,2})(?:[,.:](\d{1,3}))?\s*-{1,2}>\s*(\d+):(\d{1,2}):(\d{1,2})(?:[,.:](\d{1,3}))?`)
+	srtIndexRe  = regexp.MustCompile(`^\s*\d+\s*$`)
+	srtFontRe   = regexp.MustCompile(`(?i)</?font[^>]*>`)
+	srtAssRe    = regexp.MustCompile(`\{\\[^}]*\}`)
+)
+
+// ParseSRT parses SubRip text. It tolerates common variants: missing cue
+// numbers, dots instead of commas, missing milliseconds, coordinates after
+// the timing and missing blank lines between cues.
+func ParseSRT(data string) (*Track, error) {
+	t := &Track{}
+	lines := splitLines(data)
+	var start, end time.Duration
+	var text []string
+	inCue := false
+	flush := func() {
+		if inCue {
+			t.appendCue(start, end, srtText(strings.Join(text, "\n")))
+		}
+		text = nil
+	}
+	for i, l := range lines {
+		if m := srtTimingRe.FindStringSubmatch(l); m != nil {
+			// previous line may hold the index of this cue
+			if len(text) > 0 && srtIndexRe.MatchString(text[len(text)-1]) {
+				text = text[:len(text)-1]
+			}
+			flush()
+			start = hmsDuration(m[1], m[2], m[3], m[4])
+			end = hmsDuration(m[5], m[6], m[7], m[8])
+			inCue = true
+			continue
+		}
+		if strings.TrimSpace(l) == "" {
+			// blank lines followed by another cue close the current one
+			if i+1 < len(lines) && srtIndexRe.MatchString(lines[i+1]) {
+				flush()
+				inCue = false
+			} else if len(text) > 0 {
+				text = append(text, "")
+			}
+			continue
+		}
+		text = append(text, l)
+	}
+	flush()
+	if len(t.Cues) == 0 {
+		return nil, ErrNoCues
+	}
+	return t, nil
+}
+
+func srtText(text string) string {
+	text = srtFontRe.ReplaceAllString(text, "")
+	text = srtAssRe.ReplaceAllString(text, "")
+	return text
+}
+
+func WriteSRT(t *Track) []byte {
+	var sb strings.Builder
+	for i, c := range t.Cues {
+		fmt.Fprintf(&sb, "%d\n%s --> %s\n%s\n\n", i+1, formatTime(c.Start, ","), formatTime(c.End, ","), c.Text)
+	}
+	return []byte(sb.String())
+}
+
+func hmsDuration(h, m, s, frac string) time.Duration {
+	hh, _ := strconv.Atoi(h)
+	mm, _ := strconv.Atoi(m)
+	ss, _ := strconv.Atoi(s)
+	for len(frac) < 3 {
+		frac += "0"
+	}
+	ms, _ := strconv.Atoi(frac)
+	return time.Duration(hh)*time.Hour + time.Duration(mm)*time.Minute +
+		time.Duration(ss)*time.Second + time.Duration(ms)*time.Millisecond
+}
+
+// formatTime formats d as hh:mm:ss<sep>mmm.
+func formatTime(d time.Duration, sep string) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+func splitLines(data string) []string {
+	data = strings.TrimPrefix(data, "\ufeff")
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+	return strings.Split(data, "\n")
+}
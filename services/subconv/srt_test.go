@@ -0,0 +1,80 @@
+package subconv
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ms(v int64) time.Duration {
+	return time.Duration(v) * time.Millisecond
+}
+
+func TestParseSRT(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []Cue
+	}{
+		{
+			name: "regular",
+			data: "1\r\n00:00:01,000 --> 00:00:02,500\r\nHello\r\nworld\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\n<i>Bye</i>\r\n",
+			want: []Cue{
+				{Start: ms(1000), End: ms(2500), Text: "Hello\nworld"},
+				{Start: ms(3000), End: ms(4000), Text: "<i>Bye</i>"},
+			},
+		},
+		{
+			name: "dots, missing index and blank lines",
+			data: "00:00:01.5 --> 00:00:02.000 X1:10 X2:20\nOne\n00:00:03.000 --> 00:00:04.000\nTwo\n",
+			want: []Cue{
+				{Start: ms(1500), End: ms(2000), Text: "One"},
+				{Start: ms(3000), End: ms(4000), Text: "Two"},
+			},
+		},
+		{
+			name: "font tags and ass overrides",
+			data: "1\n00:00:01,000 --> 00:00:02,000\n{\\an8}<font color=\"red\">Red</font> <b>bold\n",
+			want: []Cue{
+				{Start: ms(1000), End: ms(2000), Text: "Red <b>bold</b>"},
+			},
+		},
+		{
+			name: "blank line inside cue",
+			data: "1\n00:00:01,000 --> 00:00:02,000\nFirst\n\nSecond\n\n2\n00:00:05,000 --> 00:00:06,000\nThird\n",
+			want: []Cue{
+				{Start: ms(1000), End: ms(2000), Text: "First\nSecond"},
+				{Start: ms(5000), End: ms(6000), Text: "Third"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSRT(tt.data)
+			if err != nil {
+				t.Fatalf("ParseSRT() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Cues, tt.want) {
+				t.Errorf("ParseSRT() = %+v, want %+v", got.Cues, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSRTNoCues(t *testing.T) {
+	if _, err := ParseSRT("just text\n"); err != ErrNoCues {
+		t.Errorf("ParseSRT() error = %v, want %v", err, ErrNoCues)
+	}
+}
+
+func TestWriteSRT(t *testing.T) {
+	tr := &Track{Cues: []Cue{
+		{Start: ms(1000), End: ms(2500), Text: "Hello\n<i>world</i>"},
+		{Start: ms(3723004), End: ms(3724000), Text: "Bye"},
+	}}
+	want := "1\n00:00:01,000 --> 00:00:02,500\nHello\n<i>world</i>\n\n" +
+		"2\n01:02:03,004 --> 01:02:04,000\nBye\n\n"
+	if got := string(WriteSRT(tr)); got != want {
+		t.Errorf("WriteSRT() = %q, want %q", got, want)
+	}
+}
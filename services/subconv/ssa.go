@@ -0,0 +1,136 @@
+package subconv
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ssaTimeRe     = regexp.MustCompile(`^\s*(\d+):(\d{1,2}):(\d{1,2})(?:\.(\d{1,3}))?\s*$`)
+	ssaOverrideRe = regexp.MustCompile(`\{[^}]*\}`)
+	ssaStyleRe    = regexp.MustCompile(`\\([ibu])([01])`)
+)
+
+var ssaDefaultFormat = []string{"layer", "start", "end", "style", "name", "marginl", "marginr", "marginv", "effect", "text"}
+
+// ParseSSA parses SubStation Alpha and Advanced SubStation Alpha subtitles.
+// Only italic, bold and underline overrides are preserved.
+func ParseSSA(data string) (*Track, error) {
+	t := &Track{}
+	format := ssaDefaultFormat
+	inEvents := false
+	for _, l := range splitLines(data) {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "[") && strings.HasSuffix(l, "]") {
+			inEvents = strings.EqualFold(l, "[Events]")
+			continue
+		}
+		if !inEvents {
+			continue
+		}
+		k, v, ok := strings.Cut(l, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "format":
+			format = nil
+			for _, f := range strings.Split(v, ",") {
+				format = append(format, strings.ToLower(strings.TrimSpace(f)))
+			}
+		case "dialogue":
+			fields := strings.SplitN(strings.TrimSpace(v), ",", len(format))
+			if len(fields) != len(format) {
+				continue
+			}
+			var start, end time.Duration
+			var text string
+			var okStart, okEnd bool
+			for i, f := range format {
+				switch f {
+				case "start":
+					start, okStart = ssaDuration(fields[i])
+				case "end":
+					end, okEnd = ssaDuration(fields[i])
+				case "text":
+					text = fields[i]
+				}
+			}
+			if !okStart || !okEnd {
+				continue
+			}
+			t.appendCue(start, end, ssaText(text))
+		}
+	}
+	if len(t.Cues) == 0 {
+		return nil, ErrNoCues
+	}
+	return t, nil
+}
+
+func ssaDuration(s string) (time.Duration, bool) {
+	m := ssaTimeRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	return hmsDuration(m[1], m[2], m[3], m[4]), true
+}
+
+// escaped braces are kept away from override blocks with private use runes
+const (
+	ssaOpenBrace  = "\ue000"
+	ssaCloseBrace = "\ue001"
+)
+
+func ssaText(text string) string {
+	text = strings.NewReplacer(`\{`, ssaOpenBrace, `\}`, ssaCloseBrace).Replace(text)
+	text = ssaOverrideRe.ReplaceAllStringFunc(text, func(o string) string {
+		var sb strings.Builder
+		for _, m := range ssaStyleRe.FindAllStringSubmatch(o, -1) {
+			if m[2] == "1" {
+				sb.WriteString("<" + m[1] + ">")
+			} else {
+				sb.WriteString("</" + m[1] + ">")
+			}
+		}
+		return sb.String()
+	})
+	text = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ", ssaOpenBrace, "{", ssaCloseBrace, "}").Replace(text)
+	return text
+}
+
+const assHeader = `[Script Info]
+ScriptType: v4.00+
+PlayResX: 384
+PlayResY: 288
+WrapStyle: 0
+ScaledBorderAndShadow: yes
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Default,Arial,16,&H00FFFFFF,&H000000FF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,1,0,2,10,10,10,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+func WriteASS(t *Track) []byte {
+	var sb strings.Builder
+	sb.WriteString(assHeader)
+	r := strings.NewReplacer("\n", `\N`, "{", `\{`, "}", `\}`, "<i>", `{\i1}`, "</i>", `{\i0}`, "<b>", `{\b1}`, "</b>", `{\b0}`, "<u>", `{\u1}`, "</u>", `{\u0}`)
+	for _, c := range t.Cues {
+		fmt.Fprintf(&sb, "Dialogue: 0,%s,%s,Default,,0,0,0,,%s\n", assTime(c.Start), assTime(c.End), r.Replace(c.Text))
+	}
+	return []byte(sb.String())
+}
+
+// assTime formats d as h:mm:ss.cc.
+func assTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
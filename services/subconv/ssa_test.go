@@ -0,0 +1,89 @@
+package subconv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSSA(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []Cue
+	}{
+		{
+			name: "ass",
+			data: "[Script Info]\nTitle: x\n\n[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+				"Dialogue: 0,0:00:01.00,0:00:02.50,Default,,0,0,0,,{\\i1}Hello{\\i0}\\Nworld, again\n" +
+				"Comment: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,,skipped\n",
+			want: []Cue{
+				{Start: ms(1000), End: ms(2500), Text: "<i>Hello</i>\nworld, again"},
+			},
+		},
+		{
+			name: "ssa with custom format",
+			data: "[Events]\nFormat: Marked, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+				"Dialogue: Marked=0,0:00:05.5,0:00:06.00,Default,,0000,0000,0000,,{\\pos(10,10)\\b1}Bold\n",
+			want: []Cue{
+				{Start: ms(5500), End: ms(6000), Text: "<b>Bold</b>"},
+			},
+		},
+		{
+			name: "escaped braces",
+			data: "[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,\\{not an override\\} {\\u1}u\n",
+			want: []Cue{
+				{Start: ms(1000), End: ms(2000), Text: "{not an override} <u>u</u>"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSSA(tt.data)
+			if err != nil {
+				t.Fatalf("ParseSSA() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Cues, tt.want) {
+				t.Errorf("ParseSSA() = %+v, want %+v", got.Cues, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteASS(t *testing.T) {
+	tests := []struct {
+		name string
+		cue  Cue
+		want string
+	}{
+		{
+			name: "markup",
+			cue:  Cue{Start: ms(1000), End: ms(2500), Text: "<i>Hello</i>\n<b>world</b>"},
+			want: "Dialogue: 0,0:00:01.00,0:00:02.50,Default,,0,0,0,,{\\i1}Hello{\\i0}\\N{\\b1}world{\\b0}\n",
+		},
+		{
+			name: "braces",
+			cue:  Cue{Start: ms(3723450), End: ms(3724000), Text: "{\\pos(1,1)} <u>x</u>"},
+			want: "Dialogue: 0,1:02:03.45,1:02:04.00,Default,,0,0,0,,\\{\\pos(1,1)\\} {\\u1}x{\\u0}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(WriteASS(&Track{Cues: []Cue{tt.cue}}))
+			if !strings.HasPrefix(got, assHeader) {
+				t.Fatalf("WriteASS() has no header")
+			}
+			if d := strings.TrimPrefix(got, assHeader); d != tt.want {
+				t.Errorf("WriteASS() = %q, want %q", d, tt.want)
+			}
+			back, err := ParseSSA(got)
+			if err != nil {
+				t.Fatalf("ParseSSA() error = %v", err)
+			}
+			if !reflect.DeepEqual(back.Cues, []Cue{tt.cue}) {
+				t.Errorf("round trip = %+v, want %+v", back.Cues, []Cue{tt.cue})
+			}
+		})
+	}
+}
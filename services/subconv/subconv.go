@@ -0,0 +1,113 @@
+package subconv
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	FormatWebVTT = "webvtt"
+	FormatSRT    = "srt"
+	FormatASS    = "ass"
+	FormatTTML   = "ttml"
+)
+
+var (
+	ErrNoCues        = errors.New("no cues found")
+	ErrUnknownFormat = errors.New("unknown subtitle format")
+)
+
+var (
+	ssaSniffRe = regexp.MustCompile(`(?im)^\s*(\[script info\]|\[events\]|dialogue:)`)
+)
+
+// Parse detects the format of data and parses it. fps is used for frame
+// based formats, pass 0 to use DefaultFPS.
+func Parse(data []byte, fps float64) (*Track, error) {
+	s := string(data)
+	var t *Track
+	var err error
+	switch detect(s) {
+	case FormatWebVTT:
+		t, err = ParseVTT(s)
+	case FormatASS:
+		t, err = ParseSSA(s)
+	case "microdvd":
+		t, err = ParseMicroDVD(s, fps)
+	case FormatSRT:
+		t, err = ParseSRT(s)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(t.Cues, func(i, j int) bool {
+		return t.Cues[i].Start < t.Cues[j].Start
+	})
+	return t, nil
+}
+
+func detect(s string) string {
+	var first string
+	for _, l := range splitLines(s) {
+		if l = strings.TrimSpace(l); l != "" {
+			first = l
+			break
+		}
+	}
+	switch {
+	case strings.HasPrefix(first, "WEBVTT"):
+		return FormatWebVTT
+	case ssaSniffRe.MatchString(s):
+		return FormatASS
+	case microDVDRe.MatchString(first) || mpl2Re.MatchString(first):
+		return "microdvd"
+	case strings.Contains(s, "-->"):
+		return FormatSRT
+	}
+	return ""
+}
+
+// CueText converts text of a single cue in format to the internal markup.
+// For ASS/SSA text is expected as stored in Matroska blocks, starting with
+// ReadOrder, Layer, Style, Name, MarginL, MarginR, MarginV and Effect fields.
+func CueText(format string, text string) string {
+	switch format {
+	case FormatSRT:
+		return srtText(text)
+	case FormatASS, "ssa":
+		fields := strings.SplitN(text, ",", 9)
+		return ssaText(fields[len(fields)-1])
+	case FormatWebVTT:
+		return vttText(text)
+	}
+	return text
+}
+
+// Write renders t in the specified format.
+func Write(t *Track, format string) ([]byte, error) {
+	switch format {
+	case FormatWebVTT:
+		return WriteVTT(t), nil
+	case FormatSRT:
+		return WriteSRT(t), nil
+	case FormatASS:
+		return WriteASS(t), nil
+	case FormatTTML:
+		return WriteTTML(t), nil
+	}
+	return nil, errors.Wrapf(ErrUnknownFormat, "format=%v", format)
+}
+
+// Convert parses data in any supported format and renders it in format.
+func Convert(data []byte, fps float64, format string) ([]byte, error) {
+	t, err := Parse(data, fps)
+	if err != nil {
+		return nil, err
+	}
+	return Write(t, format)
+}
@@ -0,0 +1,78 @@
+package subconv
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+		err  error
+	}{
+		{name: "srt", data: "1\n00:00:01,000 --> 00:00:02,000\nHi\n", want: "Hi"},
+		{name: "vtt", data: "\ufeffWEBVTT\n\n00:01.000 --> 00:02.000\nHi\n", want: "Hi"},
+		{name: "ssa", data: "[Script Info]\n\n[Events]\nDialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Hi\n", want: "Hi"},
+		{name: "microdvd", data: "{1}{2}Hi\n", want: "Hi"},
+		{name: "mpl2", data: "[1][2]Hi\n", want: "Hi"},
+		{name: "unknown", data: "Hi\n", err: ErrUnknownFormat},
+		{name: "no cues", data: "WEBVTT\n\n", err: ErrNoCues},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.data), 0)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if len(got.Cues) != 1 || got.Cues[0].Text != tt.want {
+				t.Errorf("Parse() = %+v, want single cue %q", got.Cues, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSortsCues(t *testing.T) {
+	got, err := Parse([]byte("00:00:05,000 --> 00:00:06,000\nB\n\n00:00:01,000 --> 00:00:02,000\nA\n"), 0)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(got.Cues) != 2 || got.Cues[0].Text != "A" || got.Cues[1].Text != "B" {
+		t.Errorf("Parse() = %+v, want sorted cues", got.Cues)
+	}
+}
+
+func TestSanitizeText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "  a  \n\n b ", want: "a\nb"},
+		{text: "<i>open", want: "<i>open</i>"},
+		{text: "close</i>", want: "close"},
+		{text: "<I><b>x</i>y</b>", want: "<i><b>x</b></i><b>y</b>"},
+		{text: "<i></i>", want: ""},
+	}
+	for _, tt := range tests {
+		if got := sanitizeText(tt.text); got != tt.want {
+			t.Errorf("sanitizeText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRetime(t *testing.T) {
+	tr := &Track{Cues: []Cue{
+		{Start: ms(500), End: ms(1000), Text: "a"},
+		{Start: ms(2500), End: ms(5000), Text: "b"},
+	}}
+	tr.ChangeFPS(25, 50)
+	tr.Shift(-ms(1000))
+	want := []Cue{{Start: ms(250), End: ms(1500), Text: "b"}}
+	if len(tr.Cues) != 1 || tr.Cues[0] != want[0] {
+		t.Errorf("retimed = %+v, want %+v", tr.Cues, want)
+	}
+}
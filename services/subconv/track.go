@@ -0,0 +1,165 @@
+package subconv
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Cue is a single timed piece of text. Text lines are separated with "\n"
+// and may carry <i>, <b> and <u> markup only.
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+type Track struct {
+	Language string
+	Cues     []Cue
+}
+
+var (
+	tagRe = regexp.MustCompile(`(?i)</?([ibu])>`)
+)
+
+// sanitizeText trims lines, drops empty ones and makes sure that markup
+// tags are properly nested and closed.
+func sanitizeText(text string) string {
+	var lines []string
+	for _, l := range strings.Split(text, "\n") {
+		l = strings.TrimSpace(l)
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	text = strings.Join(lines, "\n")
+	var sb strings.Builder
+	var stack []string
+	last := 0
+	for _, m := range tagRe.FindAllStringSubmatchIndex(text, -1) {
+		sb.WriteString(text[last:m[0]])
+		last = m[1]
+		tag := strings.ToLower(text[m[2]:m[3]])
+		if text[m[0]+1] != '/' {
+			if contains(stack, tag) {
+				continue
+			}
+			stack = append(stack, tag)
+			sb.WriteString("<" + tag + ">")
+			continue
+		}
+		if !contains(stack, tag) {
+			continue
+		}
+		var reopen []string
+		for len(stack) > 0 {
+			t := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			sb.WriteString("</" + t + ">")
+			if t == tag {
+				break
+			}
+			reopen = append(reopen, t)
+		}
+		for i := len(reopen) - 1; i >= 0; i-- {
+			stack = append(stack, reopen[i])
+			sb.WriteString("<" + reopen[i] + ">")
+		}
+	}
+	sb.WriteString(text[last:])
+	for i := len(stack) - 1; i >= 0; i-- {
+		sb.WriteString("</" + stack[i] + ">")
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(sb.String(), "<i></i>", ""), "<b></b>", ""), "<u></u>", "")
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// appendCue adds cue to the track if it carries any text and has valid timing.
+func (t *Track) appendCue(start time.Duration, end time.Duration, text string) {
+	text = sanitizeText(text)
+	if text == "" || start < 0 {
+		return
+	}
+	if end <= start {
+		end = start + 2*time.Second
+	}
+	t.Cues = append(t.Cues, Cue{Start: start, End: end, Text: text})
+}
+
+func plainText(text string) string {
+	return tagRe.ReplaceAllString(text, "")
+}
+
+// Shift moves all cues by d. Cues which end before zero are dropped.
+func (t *Track) Shift(d time.Duration) {
+	var cues []Cue
+	for _, c := range t.Cues {
+		c.Start += d
+		c.End += d
+		if c.End <= 0 {
+			continue
+		}
+		if c.Start < 0 {
+			c.Start = 0
+		}
+		cues = append(cues, c)
+	}
+	t.Cues = cues
+}
+
+// End returns end time of the last cue.
+func (t *Track) End() time.Duration {
+	var end time.Duration
+	for _, c := range t.Cues {
+		if c.End > end {
+			end = c.End
+		}
+	}
+	return end
+}
+
+// Concat joins tracks one after another, each track is shifted by the end
+// time of the previous one.
+func Concat(tracks ...*Track) *Track {
+	res := &Track{}
+	var offset time.Duration
+	for _, t := range tracks {
+		if res.Language == "" {
+			res.Language = t.Language
+		}
+		for _, c := range t.Cues {
+			c.Start += offset
+			c.End += offset
+			res.Cues = append(res.Cues, c)
+		}
+		offset = res.End()
+	}
+	return res
+}
+
+// ChangeFPS converts timing of subtitle made for video with from framerate
+// to video with to framerate.
+func (t *Track) ChangeFPS(from float64, to float64) {
+	if from <= 0 || to <= 0 || from == to {
+		return
+	}
+	ratio := from / to
+	for i := range t.Cues {
+		t.Cues[i].Start = time.Duration(float64(t.Cues[i].Start) * ratio)
+		t.Cues[i].End = time.Duration(float64(t.Cues[i].End) * ratio)
+	}
+}
+
+// Add adds cue with text in internal markup, see CueText.
+func (t *Track) Add(start time.Duration, end time.Duration, text string) {
+	t.appendCue(start, end, text)
+}
@@ -0,0 +1,30 @@
+package subconv
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+func WriteTTML(t *Track) []byte {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	lang := ""
+	if t.Language != "" {
+		lang = fmt.Sprintf(` xml:lang="%s"`, html.EscapeString(t.Language))
+	}
+	fmt.Fprintf(&sb, `<tt xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling"%s>`+"\n", lang)
+	sb.WriteString("<body>\n<div>\n")
+	r := strings.NewReplacer(
+		"\n", "<br/>",
+		"<i>", `<span tts:fontStyle="italic">`,
+		"<b>", `<span tts:fontWeight="bold">`,
+		"<u>", `<span tts:textDecoration="underline">`,
+		"</i>", "</span>", "</b>", "</span>", "</u>", "</span>",
+	)
+	for _, c := range t.Cues {
+		fmt.Fprintf(&sb, `<p begin="%s" end="%s">%s</p>`+"\n", formatTime(c.Start, "."), formatTime(c.End, "."), r.Replace(escapeText(c.Text)))
+	}
+	sb.WriteString("</div>\n</body>\n</tt>\n")
+	return []byte(sb.String())
+}
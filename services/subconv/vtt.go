@@ -0,0 +1,83 @@
+package subconv
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	vttTimingRe = regexp.MustCompile(`^\s*(?:(\d+):)?(\d{1,2}):(\d{1,2})\.(\d{1,3})\s+-->\s+(?:(\d+):)?(\d{1,2}):(\d{1,2})\.(\d{1,3})`)
+	vttTagRe    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ParseVTT parses WebVTT. Notes, styles and regions are skipped, cue
+// settings are dropped and only italic, bold and underline markup is kept.
+func ParseVTT(data string) (*Track, error) {
+	t := &Track{}
+	var blocks [][]string
+	var block []string
+	for _, l := range splitLines(data) {
+		if strings.TrimSpace(l) == "" {
+			if len(block) > 0 {
+				blocks = append(blocks, block)
+			}
+			block = nil
+			continue
+		}
+		block = append(block, l)
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+	for _, b := range blocks {
+		for i, l := range b {
+			m := vttTimingRe.FindStringSubmatch(l)
+			if m == nil {
+				continue
+			}
+			start := hmsDuration(m[1], m[2], m[3], m[4])
+			end := hmsDuration(m[5], m[6], m[7], m[8])
+			t.appendCue(start, end, vttText(strings.Join(b[i+1:], "\n")))
+			break
+		}
+	}
+	if len(t.Cues) == 0 {
+		return nil, ErrNoCues
+	}
+	return t, nil
+}
+
+func vttText(text string) string {
+	text = vttTagRe.ReplaceAllStringFunc(text, func(tag string) string {
+		if tagRe.MatchString(tag) {
+			return tag
+		}
+		return ""
+	})
+	return html.UnescapeString(text)
+}
+
+func WriteVTT(t *Track) []byte {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n\n")
+	for _, c := range t.Cues {
+		fmt.Fprintf(&sb, "%s --> %s\n%s\n\n", formatTime(c.Start, "."), formatTime(c.End, "."), escapeText(c.Text))
+	}
+	return []byte(sb.String())
+}
+
+// escapeText escapes markup-sensitive characters, leaving supported tags
+// intact.
+func escapeText(text string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range tagRe.FindAllStringIndex(text, -1) {
+		sb.WriteString(html.EscapeString(text[last:m[0]]))
+		sb.WriteString(text[m[0]:m[1]])
+		last = m[1]
+	}
+	sb.WriteString(html.EscapeString(text[last:]))
+	return sb.String()
+}
@@ -0,0 +1,51 @@
+package subconv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVTT(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []Cue
+	}{
+		{
+			name: "regular",
+			data: "WEBVTT\n\n00:01.000 --> 00:02.000\nHello\n\n00:00:03.000 --> 00:00:04.000 align:start\n<i>Bye</i>\n",
+			want: []Cue{
+				{Start: ms(1000), End: ms(2000), Text: "Hello"},
+				{Start: ms(3000), End: ms(4000), Text: "<i>Bye</i>"},
+			},
+		},
+		{
+			name: "identifiers, notes and styles",
+			data: "WEBVTT - title\n\nNOTE some note\n\nSTYLE\n::cue { color: red }\n\nintro\n00:00:01.000 --> 00:00:02.000\n<v Bob>Hi &amp; <c.yellow>bye</c>\n",
+			want: []Cue{
+				{Start: ms(1000), End: ms(2000), Text: "Hi & bye"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVTT(tt.data)
+			if err != nil {
+				t.Fatalf("ParseVTT() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Cues, tt.want) {
+				t.Errorf("ParseVTT() = %+v, want %+v", got.Cues, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteVTT(t *testing.T) {
+	tr := &Track{Cues: []Cue{
+		{Start: ms(1000), End: ms(2500), Text: "<b>Tom & Jerry</b> <3"},
+	}}
+	want := "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\n<b>Tom &amp; Jerry</b> &lt;3\n\n"
+	if got := string(WriteVTT(tr)); got != want {
+		t.Errorf("WriteVTT() = %q, want %q", got, want)
+	}
+}
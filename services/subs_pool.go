@@ -24,28 +24,58 @@ type SubsPool struct {
 	expire time.Duration
 	mux    sync.Mutex
 	s3     *s3.S3Storage
-	cl     *osdb.Client
 }
 
-func NewSubsPool(cl *osdb.Client, s3 *s3.S3Storage) *SubsPool {
+func NewSubsPool(s3 *s3.S3Storage) *SubsPool {
 	return &SubsPool{
 		expire: time.Duration(SubTTL) * time.Second,
-		cl:     cl,
 		s3:     s3,
 	}
 }
 
-func (s *SubsPool) Get(ctx context.Context, sub *osdb.Subtitle, format string, c *redis.Cache, purge bool, logger *logrus.Entry) ([]byte, error) {
-	if len(sub.Attributes.Files) == 0 {
-		return nil, errors.Errorf("no files for subtitle")
+// Get returns subtitle file in specific format. cd selects single part of
+// multi-CD subtitle, with cd=0 all parts are merged into one track.
+// stale is true when subtitle is served from previous copy while osdb is down.
+func (s *SubsPool) Get(ctx context.Context, p Provider, sub *osdb.Subtitle, cd int, format string, c *redis.Cache, purge bool, logger *logrus.Entry) (d []byte, stale bool, err error) {
+	files := sub.SortedFiles()
+	if len(files) == 0 {
+		return nil, false, errors.Errorf("no files for subtitle")
 	}
-	id := sub.Attributes.Files[0].FileId
-	key := strconv.Itoa(id) + format
+	var su *Sub
+	if cd > 0 {
+		if cd > len(files) {
+			return nil, false, errors.Errorf("no part cd=%v for subtitle", cd)
+		}
+		su = s.getFile(p, sub, files[cd-1].FileId, format, c, purge, logger)
+	} else if len(files) == 1 {
+		su = s.getFile(p, sub, files[0].FileId, format, c, purge, logger)
+	} else {
+		var parts []*Sub
+		for _, f := range files {
+			parts = append(parts, s.getFile(p, sub, f.FileId, OriginalFormat, c, purge, logger))
+		}
+		key := p.Name() + "/" + strconv.Itoa(files[0].FileId) + mergedPrefix + format
+		su = s.load(key, NewMergedSub(sub, format, parts, p, c, s.s3, logger), purge)
+	}
+	d, err = su.Get(ctx, purge)
+	return d, su.Stale(), err
+}
+
+func (s *SubsPool) getFile(p Provider, sub *osdb.Subtitle, id int, format string, c *redis.Cache, purge bool, logger *logrus.Entry) *Sub {
+	var orig *Sub
+	if format != OriginalFormat {
+		orig = s.getFile(p, sub, id, OriginalFormat, c, purge, logger)
+	}
+	key := p.Name() + "/" + strconv.Itoa(id) + format
+	return s.load(key, NewSub(sub, id, format, orig, p, c, s.s3, logger), purge)
+}
+
+func (s *SubsPool) load(key string, sub *Sub, purge bool) *Sub {
 	if purge {
-		s.sm.Delete(id)
-		s.timers.Delete(id)
+		s.sm.Delete(key)
+		s.timers.Delete(key)
 	}
-	v, _ := s.sm.LoadOrStore(key, NewSub(sub, format, s.cl, c, s.s3, logger))
+	v, _ := s.sm.LoadOrStore(key, sub)
 	t, tLoaded := s.timers.LoadOrStore(key, time.NewTimer(s.expire))
 	timer := t.(*time.Timer)
 	if !tLoaded {
@@ -59,5 +89,5 @@ func (s *SubsPool) Get(ctx context.Context, sub *osdb.Subtitle, format string, c
 		timer.Reset(s.expire)
 		s.mux.Unlock()
 	}
-	return v.(*Sub).Get(ctx, purge)
+	return v.(*Sub)
 }
@@ -5,30 +5,37 @@ import (
 	"encoding/json"
 	"fmt"
 	iso6391 "github.com/emvi/iso-639-1"
+	"math"
 	"net"
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/webtor-io/video-info/services/redis"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"github.com/webtor-io/video-info/services/media"
 	"github.com/webtor-io/video-info/services/osdb"
+	"github.com/webtor-io/video-info/services/subconv"
 
 	logrusmiddleware "github.com/bakins/logrus-middleware"
 )
 
 type Web struct {
-	host           string
-	port           int
-	ln             net.Listener
-	searchPool     *SearchPool
-	imdbSearchPool *IMDBSearchPool
-	subsPool       *SubsPool
-	cachePool      *redis.CachePool
-	sourceURL      string
+	host          string
+	port          int
+	ln            net.Listener
+	providers     *Providers
+	searchChain   *SearchChain
+	subsPool      *SubsPool
+	embeddedPool  *EmbeddedSubsPool
+	mediaInfoPool *MediaInfoPool
+	cachePool     *redis.CachePool
+	ranker        *Ranker
+	sourceURL     string
 }
 
 const (
@@ -37,25 +44,78 @@ const (
 	WebSourceURL = "source-url"
 )
 
+// staleWarning marks responses made from expired cache while osdb is down
+const staleWarning = `110 - "Response is Stale"`
+
+// originalCharsetHeader tells charset of subtitle file before it was
+// converted to UTF-8
+const originalCharsetHeader = "X-Original-Charset"
+
 type Subtitle struct {
-	SrcLang string `json:"srclang"`
-	Label   string `json:"label"`
-	Src     string `json:"src"`
-	Format  string `json:"format"`
-	ID      string `json:"id"`
+	SrcLang   string         `json:"srclang"`
+	Label     string         `json:"label"`
+	Src       string         `json:"src"`
+	Format    string         `json:"format"`
+	ID        string         `json:"id"`
+	Provider  string         `json:"provider,omitempty"`
+	MatchedBy string         `json:"matched_by,omitempty"`
+	Embedded  bool           `json:"embedded,omitempty"`
+	Kind      string         `json:"kind,omitempty"`
+	Stale     bool           `json:"stale,omitempty"`
+	Parts     []SubtitlePart `json:"parts,omitempty"`
+	*SubtitleDetails
+}
+
+// SubtitlePart is a single file of multi-CD subtitle
+type SubtitlePart struct {
+	CD  int    `json:"cd"`
+	Src string `json:"src"`
+}
+
+// SubtitleDetails is included only in extended response mode
+type SubtitleDetails struct {
+	HearingImpaired   bool    `json:"hearing_impaired"`
+	ForeignPartsOnly  bool    `json:"foreign_parts_only"`
+	Fps               float64 `json:"fps"`
+	Release           string  `json:"release"`
+	Ratings           float64 `json:"ratings"`
+	DownloadCount     int     `json:"download_count"`
+	AiTranslated      bool    `json:"ai_translated"`
+	MachineTranslated bool    `json:"machine_translated"`
+	Uploader          string  `json:"uploader"`
+	UploaderRank      string  `json:"uploader_rank"`
+}
+
+func makeSubtitleDetails(s *osdb.Subtitle) *SubtitleDetails {
+	a := &s.Attributes
+	return &SubtitleDetails{
+		HearingImpaired:   a.HearingImpaired,
+		ForeignPartsOnly:  a.ForeignPartsOnly,
+		Fps:               a.Fps,
+		Release:           a.Release,
+		Ratings:           a.Ratings,
+		DownloadCount:     a.DownloadCount,
+		AiTranslated:      a.AiTranslated,
+		MachineTranslated: a.MachineTranslated,
+		Uploader:          a.Uploader.Name,
+		UploaderRank:      a.Uploader.Rank,
+	}
 }
 
 type Subtitles []Subtitle
 
-func NewWeb(c *cli.Context, sp *SearchPool, isp *IMDBSearchPool, sbp *SubsPool, cp *redis.CachePool) *Web {
+func NewWeb(c *cli.Context, pr *Providers, sc *SearchChain, sbp *SubsPool, esp *EmbeddedSubsPool, mip *MediaInfoPool, cp *redis.CachePool, rk *Ranker) *Web {
 	return &Web{
-		sourceURL:      c.String(WebSourceURL),
-		host:           c.String(WebHostFlag),
-		port:           c.Int(WebPortFlag),
-		searchPool:     sp,
-		imdbSearchPool: isp,
-		subsPool:       sbp,
-		cachePool:      cp,
+		sourceURL:     c.String(WebSourceURL),
+		host:          c.String(WebHostFlag),
+		port:          c.Int(WebPortFlag),
+		providers:     pr,
+		searchChain:   sc,
+		subsPool:      sbp,
+		embeddedPool:  esp,
+		mediaInfoPool: mip,
+		cachePool:     cp,
+		ranker:        rk,
 	}
 }
 
@@ -95,38 +155,117 @@ func getPath(r *http.Request) string {
 	return r.Header.Get("X-Path")
 }
 
-func getCacheKey(r *http.Request) string {
-	return r.Header.Get("X-Info-Hash") + r.Header.Get("X-Path") + r.URL.Query().Get("imdb-id")
+// getSourceKey returns key identifying the source video itself, source url
+// is used when the video comes without info hash and path.
+func (s *Web) getSourceKey(r *http.Request) string {
+	if key := r.Header.Get("X-Info-Hash") + r.Header.Get("X-Path"); key != "" {
+		return key
+	}
+	return s.getSourceURL(r)
 }
 
-func (s *Web) search(ctx context.Context, sourceURL string, imdbID string, purge bool, cache *redis.Cache, logger *log.Entry) ([]osdb.Subtitle, error) {
-	var subs []osdb.Subtitle
-	var err error
-	if imdbID != "" {
-		logger.Info("fetching subtitles by IMDB id")
-		subs, err = s.imdbSearchPool.Get(ctx, imdbID, cache, purge)
-	} else if sourceURL != "" {
-		logger.Info("fetching subtitles by hash and file size")
-		subs, err = s.searchPool.Get(ctx, sourceURL, cache, purge)
-	} else {
-		err = errors.Errorf("no data provided to find subtitles")
+// getMediaInfo probes the source container. Errors are only logged, so
+// listing works for sources without container support.
+func (s *Web) getMediaInfo(r *http.Request, purge bool, logger *log.Entry) *media.Info {
+	sourceURL := s.getSourceURL(r)
+	if sourceURL == "" {
+		return nil
 	}
-	return subs, err
+	info, err := s.mediaInfoPool.Get(r.Context(), sourceURL, s.cachePool.Get(s.getSourceKey(r)), purge)
+	if err != nil {
+		logger.WithError(err).Warn("failed to get media info")
+		return nil
+	}
+	return info
+}
+
+// embeddedSubtitles lists text tracks of the source container.
+func embeddedSubtitles(info *media.Info, langs []string) Subtitles {
+	res := Subtitles{}
+	if info == nil {
+		return res
+	}
+	for _, t := range info.Subtitles {
+		if !media.IsTextCodec(t.Codec) {
+			continue
+		}
+		lang := normalizeLanguage(t.Language)
+		if len(langs) > 0 && languageRank(lang, langs) == -1 {
+			continue
+		}
+		label := t.Name
+		if label == "" {
+			label = iso6391.Name(lang)
+		}
+		if label == "" {
+			label = fmt.Sprintf("Track %v", t.ID)
+		}
+		res = append(res, Subtitle{
+			SrcLang:  lang,
+			Label:    label,
+			Src:      fmt.Sprintf("/embedded/%v.%v", t.ID, "vtt"),
+			Format:   "vtt",
+			ID:       fmt.Sprintf("embedded-%v", t.ID),
+			Embedded: true,
+		})
+	}
+	return res
+}
+
+// rank ranks subtitles of every provider separately and lists them in order
+// of provider priority, so curated sources are never pushed down or cut by
+// popular ones.
+func (s *Web) rank(subs []osdb.Subtitle, r *http.Request, langs []string) []osdb.Subtitle {
+	var res []osdb.Subtitle
+	for _, p := range s.providers.List() {
+		var ps []osdb.Subtitle
+		for _, sub := range subs {
+			if sub.Provider == p.Name() {
+				ps = append(ps, sub)
+			}
+		}
+		ps = s.ranker.Rank(ps, getPath(r))
+		if len(langs) == 0 {
+			ps = orderByLanguages(ps, getAcceptLanguages(r))
+		}
+		res = append(res, ps...)
+	}
+	return res
+}
+
+func getQuery(r *http.Request) osdb.Query {
+	q := r.URL.Query()
+	year, _ := strconv.Atoi(q.Get("year"))
+	season, _ := strconv.Atoi(q.Get("season"))
+	episode, _ := strconv.Atoi(q.Get("episode"))
+	return osdb.Query{
+		Query:        q.Get("query"),
+		Year:         year,
+		Season:       season,
+		Episode:      episode,
+		ParentIMDBID: q.Get("parent-imdb-id"),
+		TMDBID:       q.Get("tmdb-id"),
+	}
+}
+
+func getCacheKey(r *http.Request) string {
+	key := r.Header.Get("X-Info-Hash") + r.Header.Get("X-Path") + r.URL.Query().Get("imdb-id")
+	if q := getQuery(r); !q.Empty() {
+		key += "query=" + q.Key()
+	}
+	if langs := getLanguages(r); len(langs) > 0 {
+		key += "languages=" + strings.Join(langs, ",")
+	}
+	return key
 }
 
 var (
 	re = regexp.MustCompile("(\\d+).([a-z]+)")
 )
 
-func (s *Web) Serve() error {
-	addr := fmt.Sprintf("%s:%d", s.host, s.port)
-	ln, err := net.Listen("tcp", addr)
-	if err != nil {
-		return errors.Wrap(err, "Failed to web listen to tcp connection")
-	}
-	s.ln = ln
-	mux := http.NewServeMux()
-	mux.HandleFunc("/opensubtitles/", func(w http.ResponseWriter, r *http.Request) {
+// subtitleHandler serves subtitles of specific provider at /{provider}/{id}.{ext}
+func (s *Web) subtitleHandler(p Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		values := re.FindStringSubmatch(r.URL.Path)
 		if len(values) == 0 {
 			w.WriteHeader(400)
@@ -135,16 +274,21 @@ func (s *Web) Serve() error {
 		sourceURL := s.getSourceURL(r)
 		purge := r.URL.Query().Get("purge") == "true"
 		imdbID := r.URL.Query().Get("imdb-id")
+		query := getQuery(r)
+		langs := getLanguages(r)
 
 		logger := log.WithFields(log.Fields{
+			"provider":  p.Name(),
 			"imdbID":    imdbID,
+			"query":     query,
+			"languages": langs,
 			"sourceURL": sourceURL,
 			"infoHash":  getInfoHash(r),
 			"path":      getPath(r),
 			"purge":     purge,
 		})
 		if len(values) == 1 {
-			logger.WithError(err).WithField("url", r.URL).Error("failed to parse URL")
+			logger.WithField("url", r.URL).Error("failed to parse URL")
 			w.WriteHeader(400)
 			return
 		}
@@ -154,9 +298,31 @@ func (s *Web) Serve() error {
 			w.WriteHeader(400)
 			return
 		}
-		logger = logger.WithField("id", id)
+		format := getFormatByExt(values[2])
+		if format == nil {
+			logger.WithField("ext", values[2]).Error("unsupported subtitle format")
+			w.WriteHeader(400)
+			return
+		}
+		cd := 0
+		if v := r.URL.Query().Get("cd"); v != "" {
+			cd, err = strconv.Atoi(v)
+			if err != nil || cd < 1 {
+				logger.WithError(err).WithField("cd", v).Error("failed to parse cd")
+				w.WriteHeader(400)
+				return
+			}
+		}
+		logger = logger.WithField("id", id).WithField("format", format.Name).WithField("cd", cd)
 		cache := s.cachePool.Get(getCacheKey(r))
-		subs, err := s.search(r.Context(), sourceURL, imdbID, purge, cache, logger)
+		subs, err := s.searchChain.Search(r.Context(), &SearchRequest{
+			SourceURL: sourceURL,
+			Path:      getPath(r),
+			IMDBID:    imdbID,
+			Query:     query,
+			Languages: langs,
+			CacheKey:  getCacheKey(r),
+		}, purge, logger)
 		if err != nil {
 			logger.WithError(err).Error("failed to get subtitles")
 			w.WriteHeader(404)
@@ -165,7 +331,7 @@ func (s *Web) Serve() error {
 
 		var sub *osdb.Subtitle
 		for _, ss := range subs {
-			if ss.Id == strconv.Itoa(id) {
+			if ss.Provider == p.Name() && ss.Id == strconv.Itoa(id) {
 				sub = &ss
 				break
 			}
@@ -175,55 +341,282 @@ func (s *Web) Serve() error {
 			w.WriteHeader(404)
 			return
 		}
+		rt, err := getRetiming(r, sub)
+		if err != nil {
+			logger.WithError(err).Error("failed to parse retiming")
+			w.WriteHeader(400)
+			return
+		}
 		logger.Info("fetching subtitle")
 
-		// src := strings.Replace(sub.SubDownloadLink, "download/", "download/subformat-vtt/", 1)
-		su, err := s.subsPool.Get(r.Context(), sub, "webvtt", cache, purge, logger)
+		// retimed subtitles are made from cached WebVTT on every request
+		f := format.Name
+		if !rt.Empty() {
+			f = subconv.FormatWebVTT
+		}
+		su, stale, err := s.subsPool.Get(r.Context(), p, sub, cd, f, cache, purge, logger)
+		var qe *osdb.QuotaError
+		if errors.As(err, &qe) {
+			logger.WithError(err).Warn("download quota exceeded")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(qe.RetryAfter().Seconds()))))
+			w.WriteHeader(503)
+			return
+		}
+		var ce *osdb.CircuitOpenError
+		if errors.As(err, &ce) {
+			logger.WithError(err).Warn("osdb is unavailable")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(ce.RetryAfter().Seconds()))))
+			w.WriteHeader(503)
+			return
+		}
 		if err != nil {
 			logger.WithError(err).Error("failed to get subtitle")
 			w.WriteHeader(404)
 			return
 		}
-		// w.Header().Set("Content-Encoding", "gzip")
-		// w.Header().Set("Content-Type", "text/vtt;charset=utf-8")
-		logger.Info("got subtitle")
+		if !rt.Empty() {
+			su, err = rt.Apply(su, format.Name, sub.Attributes.Language)
+			if err != nil {
+				logger.WithError(err).WithField("retiming", rt).Error("failed to retime subtitle")
+				w.WriteHeader(500)
+				return
+			}
+		}
+		logger.WithField("stale", stale).Info("got subtitle")
+		if stale {
+			w.Header().Set("Warning", staleWarning)
+		}
+		cs, err := getOriginalCharset(r.Context(), p, sub, cd, cache)
+		if err != nil {
+			logger.WithError(err).Warn("failed to get original charset")
+		}
+		if cs != "" {
+			w.Header().Set(originalCharsetHeader, cs)
+		}
+		w.Header().Set("Content-Type", format.ContentType)
 		w.Write(su)
-	})
+	}
+}
+
+// getOriginalCharset returns charset detected on download of requested
+// subtitle part. Merged parts have common charset only if all of them agree.
+func getOriginalCharset(ctx context.Context, p Provider, sub *osdb.Subtitle, cd int, c *redis.Cache) (string, error) {
+	files := sub.SortedFiles()
+	if cd > 0 && cd <= len(files) {
+		files = files[cd-1 : cd]
+	}
+	res := ""
+	for i, f := range files {
+		cs, err := c.GetSubtitleCharset(ctx, p.Name(), f.FileId)
+		if err != nil {
+			return "", err
+		}
+		if cs == "" || (i > 0 && cs != res) {
+			return "", nil
+		}
+		res = cs
+	}
+	return res, nil
+}
+
+func (s *Web) Serve() error {
+	addr := fmt.Sprintf("%s:%d", s.host, s.port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "Failed to web listen to tcp connection")
+	}
+	s.ln = ln
+	mux := http.NewServeMux()
+	for _, p := range s.providers.List() {
+		mux.HandleFunc("/"+p.Name()+"/", s.subtitleHandler(p))
+	}
 	mux.HandleFunc("/subtitles.json", func(w http.ResponseWriter, r *http.Request) {
 		purge := r.URL.Query().Get("purge") == "true"
+		extended := r.URL.Query().Get("extended") == "true"
 		imdbID := r.URL.Query().Get("imdb-id")
+		query := getQuery(r)
 		sourceURL := s.getSourceURL(r)
+		langs := getLanguages(r)
 		logger := log.WithFields(log.Fields{
 			"imdbID":    imdbID,
+			"query":     query,
+			"languages": langs,
 			"infoHash":  getInfoHash(r),
 			"path":      getPath(r),
 			"sourceURL": sourceURL,
 			"purge":     purge,
 		})
-		subs, err := s.search(r.Context(), sourceURL, imdbID, purge, s.cachePool.Get(getCacheKey(r)), logger)
-		if err != nil {
+		// embedded tracks are always in sync with the video, so they go first
+		info := s.getMediaInfo(r, purge, logger)
+		res := embeddedSubtitles(info, langs)
+		subs, err := s.searchChain.Search(r.Context(), &SearchRequest{
+			SourceURL: sourceURL,
+			Path:      getPath(r),
+			IMDBID:    imdbID,
+			Query:     query,
+			Languages: langs,
+			CacheKey:  getCacheKey(r),
+		}, purge, logger)
+		if err != nil && len(res) == 0 {
 			logger.WithError(err).Error("failed to get subtitles")
 			w.WriteHeader(404)
 			return
 		}
-		res := Subtitles{}
+		if err != nil {
+			logger.WithError(err).Warn("failed to get subtitles, serving embedded only")
+		}
+		subs = s.rank(subs, r, langs)
 		for _, s := range subs {
 			label := iso6391.Name(s.Attributes.Language)
 			if label == "" {
 				label = s.Attributes.Language
 			}
+			st := Subtitle{
+				SrcLang:   s.Attributes.Language,
+				Label:     label,
+				Src:       fmt.Sprintf("/%v/%v.%v", s.Provider, s.Id, "vtt"),
+				Format:    "vtt",
+				ID:        s.Id,
+				Provider:  s.Provider,
+				MatchedBy: s.MatchedBy,
+				Stale:     s.Stale,
+			}
+			if s.Stale {
+				w.Header().Set("Warning", staleWarning)
+			}
+			if len(s.Attributes.Files) > 1 {
+				for i := range s.Attributes.Files {
+					st.Parts = append(st.Parts, SubtitlePart{
+						CD:  i + 1,
+						Src: fmt.Sprintf("/%v/%v.%v?cd=%v", s.Provider, s.Id, "vtt", i+1),
+					})
+				}
+			}
+			if extended {
+				st.SubtitleDetails = makeSubtitleDetails(&s)
+			}
+			res = append(res, st)
+		}
+		if info != nil && len(info.Chapters) > 0 {
 			res = append(res, Subtitle{
-				SrcLang: s.Attributes.Language,
-				Label:   label,
-				Src:     fmt.Sprintf("/opensubtitles/%v.%v", s.Id, "vtt"),
-				Format:  "vtt",
-				ID:      s.Id,
+				Label:  "Chapters",
+				Src:    "/chapters.vtt",
+				Format: "vtt",
+				ID:     chaptersKind,
+				Kind:   chaptersKind,
 			})
 		}
 		logger.WithField("subtitles", res).Infof("got subtitles")
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(res)
 	})
+	mux.HandleFunc("/embedded/", func(w http.ResponseWriter, r *http.Request) {
+		values := re.FindStringSubmatch(r.URL.Path)
+		purge := r.URL.Query().Get("purge") == "true"
+		sourceURL := s.getSourceURL(r)
+		logger := log.WithFields(log.Fields{
+			"infoHash":  getInfoHash(r),
+			"path":      getPath(r),
+			"sourceURL": sourceURL,
+			"purge":     purge,
+		})
+		if len(values) < 3 {
+			logger.WithField("url", r.URL).Error("failed to parse URL")
+			w.WriteHeader(400)
+			return
+		}
+		if sourceURL == "" {
+			logger.Error("no source url provided")
+			w.WriteHeader(400)
+			return
+		}
+		track, err := strconv.Atoi(values[1])
+		if err != nil {
+			logger.WithError(err).WithField("track", values[1]).Error("failed to parse track")
+			w.WriteHeader(400)
+			return
+		}
+		format := getFormatByExt(values[2])
+		if format == nil {
+			logger.WithField("ext", values[2]).Error("unsupported subtitle format")
+			w.WriteHeader(400)
+			return
+		}
+		logger = logger.WithField("track", track).WithField("format", format.Name)
+		key := s.getSourceKey(r)
+		su, err := s.embeddedPool.Get(r.Context(), sourceURL, key, track, format.Name, s.cachePool.Get(key), purge, logger)
+		if err != nil {
+			logger.WithError(err).Error("failed to get embedded subtitle")
+			w.WriteHeader(404)
+			return
+		}
+		logger.Info("got embedded subtitle")
+		w.Header().Set("Content-Type", format.ContentType)
+		w.Write(su)
+	})
+	mux.HandleFunc("/chapters.vtt", func(w http.ResponseWriter, r *http.Request) {
+		purge := r.URL.Query().Get("purge") == "true"
+		sourceURL := s.getSourceURL(r)
+		logger := log.WithFields(log.Fields{
+			"infoHash":  getInfoHash(r),
+			"path":      getPath(r),
+			"sourceURL": sourceURL,
+			"purge":     purge,
+		})
+		if sourceURL == "" {
+			logger.Error("no source url provided")
+			w.WriteHeader(400)
+			return
+		}
+		info, err := s.mediaInfoPool.Get(r.Context(), sourceURL, s.cachePool.Get(s.getSourceKey(r)), purge)
+		if err != nil {
+			logger.WithError(err).Error("failed to get media info")
+			w.WriteHeader(404)
+			return
+		}
+		if len(info.Chapters) == 0 {
+			logger.Info("no chapters found")
+			w.WriteHeader(404)
+			return
+		}
+		logger.WithField("chapters", len(info.Chapters)).Info("got chapters")
+		w.Header().Set("Content-Type", getFormatByExt("vtt").ContentType)
+		w.Write(makeChaptersVTT(info.Chapters))
+	})
+	mux.HandleFunc("/quota.json", func(w http.ResponseWriter, r *http.Request) {
+		res := map[string][]osdb.Quota{}
+		for _, p := range s.providers.List() {
+			if qr, ok := p.(QuotaReporter); ok {
+				res[p.Name()] = qr.Quotas()
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	})
+	mux.HandleFunc("/info.json", func(w http.ResponseWriter, r *http.Request) {
+		purge := r.URL.Query().Get("purge") == "true"
+		sourceURL := s.getSourceURL(r)
+		logger := log.WithFields(log.Fields{
+			"infoHash":  getInfoHash(r),
+			"path":      getPath(r),
+			"sourceURL": sourceURL,
+			"purge":     purge,
+		})
+		if sourceURL == "" {
+			logger.Error("no source url provided")
+			w.WriteHeader(400)
+			return
+		}
+		info, err := s.mediaInfoPool.Get(r.Context(), sourceURL, s.cachePool.Get(s.getSourceKey(r)), purge)
+		if err != nil {
+			logger.WithError(err).Error("failed to get media info")
+			w.WriteHeader(404)
+			return
+		}
+		logger.WithField("info", info).Info("got media info")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	})
 	log.Infof("Serving Web at %v", addr)
 
 	logger := log.New()